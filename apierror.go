@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// APIFieldError is validation error of single field. Field is a path like "forward.host" or "[1].key"
+type APIFieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// APIError is error returned by admin API as JSON body
+type APIError struct {
+	Status  int             `json:"status"`
+	Message string          `json:"message"`
+	Fields  []APIFieldError `json:"fields,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	if len(e.Fields) == 0 {
+		return e.Message
+	}
+	fields := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		fields = append(fields, field.Field+": "+field.Message)
+	}
+	return e.Message + ": " + strings.Join(fields, "; ")
+}
+
+// APIBadRequest returns error for request which can't be parsed
+func APIBadRequest(message string, fields ...APIFieldError) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Message: message, Fields: fields}
+}
+
+// APIUnprocessable returns error for parsed request with invalid values
+func APIUnprocessable(message string, fields ...APIFieldError) *APIError {
+	return &APIError{Status: http.StatusUnprocessableEntity, Message: message, Fields: fields}
+}
+
+// APIInternal returns error of server which isn't caused by request, like failed write to expectations store
+func APIInternal(message string) *APIError {
+	return &APIError{Status: http.StatusInternalServerError, Message: message}
+}
+
+// APIDecodeJSON decodes JSON from reader to v. Errors are described with position or field of wrong value
+func APIDecodeJSON(reader io.Reader, v interface{}) *APIError {
+	err := json.NewDecoder(reader).Decode(v)
+	if err == nil {
+		return nil
+	}
+	return apiJSONError(err)
+}
+
+func apiJSONError(err error) *APIError {
+	switch jsonErr := err.(type) {
+	case *json.SyntaxError:
+		return APIBadRequest(fmt.Sprintf("invalid JSON at offset %d: %s", jsonErr.Offset, jsonErr))
+	case *json.UnmarshalTypeError:
+		field := jsonErr.Field
+		if field == "" {
+			return APIBadRequest(fmt.Sprintf("JSON %s can't be used as %s", jsonErr.Value, jsonErr.Type))
+		}
+		return APIBadRequest("invalid JSON value", APIFieldError{
+			Field:   field,
+			Message: fmt.Sprintf("JSON %s can't be used as %s", jsonErr.Value, jsonErr.Type)})
+	}
+	if err == io.EOF {
+		return APIBadRequest("body is empty")
+	}
+	if err == io.ErrUnexpectedEOF {
+		return APIBadRequest("invalid JSON: unexpected end of body")
+	}
+	return APIBadRequest("invalid JSON: " + err.Error())
+}
+
+// apiWriteError writes error as JSON body. Errors which aren't APIError are returned with status 400
+func apiWriteError(w http.ResponseWriter, err error) {
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		apiErr = APIBadRequest(err.Error())
+	}
+	body, _ := json.Marshal(apiErr)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.Status)
+	w.Write(body)
+}
+
+// apiCheckMethod writes 405 error and returns false if request method isn't allowed
+func apiCheckMethod(w http.ResponseWriter, r *http.Request, allowed ...string) bool {
+	for _, method := range allowed {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	apiWriteError(w, &APIError{
+		Status:  http.StatusMethodNotAllowed,
+		Message: fmt.Sprintf("method %s is not allowed, use %s", r.Method, strings.Join(allowed, " or "))})
+	return false
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIError_Fields_ListedInError(t *testing.T) {
+	err := APIUnprocessable("expectation is invalid", APIFieldError{Field: "key", Message: "key is required"})
+	assert.Equal(t, "expectation is invalid: key: key is required", err.Error())
+	assert.Equal(t, "body is empty", APIBadRequest("body is empty").Error())
+}
+
+func TestAPIDecodeJSON_Errors(t *testing.T) {
+	var v struct {
+		Count int `json:"count"`
+	}
+	assert.Nil(t, APIDecodeJSON(strings.NewReader(`{"count":1}`), &v))
+	assert.Equal(t, "body is empty", APIDecodeJSON(strings.NewReader(""), &v).Message)
+	assert.Equal(t, "invalid JSON: unexpected end of body", APIDecodeJSON(strings.NewReader(`{"count":`), &v).Message)
+	assert.Contains(t, APIDecodeJSON(strings.NewReader(`{"count":}`), &v).Message, "invalid JSON at offset 10")
+
+	apiErr := APIDecodeJSON(strings.NewReader(`{"count":"1"}`), &v)
+	assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+	assert.Equal(t, []APIFieldError{{Field: "count", Message: "JSON string can't be used as int"}}, apiErr.Fields)
+}
+
+func TestAPIWriteError_JSONBody(t *testing.T) {
+	httpTestResponseRecorder := httptest.NewRecorder()
+	apiWriteError(httpTestResponseRecorder, APIUnprocessable("invalid", APIFieldError{Field: "key", Message: "required"}))
+	assert.Equal(t, http.StatusUnprocessableEntity, httpTestResponseRecorder.Code)
+	assert.Equal(t, "application/json", httpTestResponseRecorder.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"status":422,"message":"invalid","fields":[{"field":"key","message":"required"}]}`, httpTestResponseRecorder.Body.String())
+
+	httpTestResponseRecorder = httptest.NewRecorder()
+	apiWriteError(httpTestResponseRecorder, errors.New("plain"))
+	assert.Equal(t, http.StatusBadRequest, httpTestResponseRecorder.Code)
+	assert.JSONEq(t, `{"status":400,"message":"plain"}`, httpTestResponseRecorder.Body.String())
+}
+
+func TestAPICheckMethod_WrongMethod_MethodNotAllowed(t *testing.T) {
+	req := httptest.NewRequest("DELETE", "/gozzmock/unmatched", nil)
+	httpTestResponseRecorder := httptest.NewRecorder()
+	assert.False(t, apiCheckMethod(httpTestResponseRecorder, req, "GET", "POST"))
+	assert.Equal(t, http.StatusMethodNotAllowed, httpTestResponseRecorder.Code)
+	assert.Equal(t, "GET, POST", httpTestResponseRecorder.Header().Get("Allow"))
+
+	apiErr := APIError{}
+	assert.NoError(t, json.Unmarshal(httpTestResponseRecorder.Body.Bytes(), &apiErr))
+	assert.Equal(t, "method DELETE is not allowed, use GET or POST", apiErr.Message)
+
+	assert.True(t, apiCheckMethod(httptest.NewRecorder(), req, "DELETE"))
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Strategies to choose forward target when several hosts are set
+const (
+	BalancerRoundRobin = "roundrobin"
+	BalancerRandom     = "random"
+	BalancerFailover   = "failover"
+)
+
+const (
+	balancerDefaultMaxFails  = 3
+	balancerDefaultEjectTime = 30
+)
+
+// balancerTarget is passive health state of single forward target
+type balancerTarget struct {
+	fails        int
+	ejectedUntil time.Time
+}
+
+// balancerState is state of forward targets of single expectation
+type balancerState struct {
+	fingerprint string
+	next        int
+	targets     map[string]*balancerTarget
+}
+
+var balancers = map[string]*balancerState{}
+
+var balancersMu sync.Mutex
+
+// BalancerHosts returns list of forward target hosts
+func BalancerHosts(fwd *ExpectationForward) []string {
+	if len(fwd.Hosts) > 0 {
+		return fwd.Hosts
+	}
+	return []string{fwd.Host}
+}
+
+// balancerGetState returns state for expectation key. State is reset if forward targets were changed
+func balancerGetState(key string, fwd *ExpectationForward) *balancerState {
+	fingerprint := fwd.Strategy + "|" + strings.Join(BalancerHosts(fwd), ",")
+	state, ok := balancers[key]
+	if !ok || state.fingerprint != fingerprint {
+		state = &balancerState{fingerprint: fingerprint, targets: map[string]*balancerTarget{}}
+		balancers[key] = state
+	}
+	return state
+}
+
+// BalancerOrderHosts returns forward target hosts in order they should be tried.
+// First host is chosen by strategy, healthy hosts go before ejected ones
+func BalancerOrderHosts(key string, fwd *ExpectationForward) []string {
+	hosts := BalancerHosts(fwd)
+	if len(hosts) == 1 {
+		return hosts
+	}
+
+	balancersMu.Lock()
+	defer balancersMu.Unlock()
+
+	state := balancerGetState(key, fwd)
+	now := time.Now()
+	healthy := []string{}
+	ejected := []string{}
+	for _, host := range hosts {
+		if target, ok := state.targets[host]; ok && now.Before(target.ejectedUntil) {
+			ejected = append(ejected, host)
+			continue
+		}
+		healthy = append(healthy, host)
+	}
+
+	if len(healthy) > 1 {
+		first := 0
+		switch fwd.Strategy {
+		case BalancerFailover:
+		case BalancerRandom:
+			first = rand.Intn(len(healthy))
+		default:
+			first = state.next % len(healthy)
+			state.next++
+		}
+		rotated := make([]string, 0, len(healthy))
+		rotated = append(rotated, healthy[first:]...)
+		healthy = append(rotated, healthy[:first]...)
+	}
+
+	return append(healthy, ejected...)
+}
+
+// BalancerReportFailure registers connection error. Target is ejected after too many consecutive errors
+func BalancerReportFailure(key string, fwd *ExpectationForward, host string) {
+	balancersMu.Lock()
+	defer balancersMu.Unlock()
+
+	state := balancerGetState(key, fwd)
+	target, ok := state.targets[host]
+	if !ok {
+		target = &balancerTarget{}
+		state.targets[host] = target
+	}
+
+	maxFails := fwd.MaxFails
+	if maxFails <= 0 {
+		maxFails = balancerDefaultMaxFails
+	}
+	ejectTime := fwd.EjectTime
+	if ejectTime <= 0 {
+		ejectTime = balancerDefaultEjectTime
+	}
+
+	target.fails++
+	if target.fails >= maxFails {
+		target.fails = 0
+		target.ejectedUntil = time.Now().Add(time.Second * ejectTime)
+	}
+}
+
+// BalancerReportSuccess resets health state of target
+func BalancerReportSuccess(key string, fwd *ExpectationForward, host string) {
+	balancersMu.Lock()
+	defer balancersMu.Unlock()
+
+	state := balancerGetState(key, fwd)
+	delete(state.targets, host)
+}
+
+// BalancerForget removes state of forward targets of expectation, it's called when expectation is removed
+func BalancerForget(key string) {
+	balancersMu.Lock()
+	defer balancersMu.Unlock()
+
+	delete(balancers, key)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBalancerOrderHosts_SingleHost_ReturnHost(t *testing.T) {
+	fwd := &ExpectationForward{Host: "h1"}
+	assert.Equal(t, []string{"h1"}, BalancerOrderHosts("balancer_single", fwd))
+}
+
+func TestBalancerOrderHosts_RoundRobin_Rotated(t *testing.T) {
+	defer BalancerForget("balancer_rr")
+	fwd := &ExpectationForward{Hosts: []string{"h1", "h2", "h3"}, Strategy: BalancerRoundRobin}
+	assert.Equal(t, []string{"h1", "h2", "h3"}, BalancerOrderHosts("balancer_rr", fwd))
+	assert.Equal(t, []string{"h2", "h3", "h1"}, BalancerOrderHosts("balancer_rr", fwd))
+	assert.Equal(t, []string{"h3", "h1", "h2"}, BalancerOrderHosts("balancer_rr", fwd))
+	assert.Equal(t, []string{"h1", "h2", "h3"}, BalancerOrderHosts("balancer_rr", fwd))
+}
+
+func TestBalancerOrderHosts_Failover_PriorityOrder(t *testing.T) {
+	fwd := &ExpectationForward{Hosts: []string{"h1", "h2"}, Strategy: BalancerFailover}
+	assert.Equal(t, []string{"h1", "h2"}, BalancerOrderHosts("balancer_failover", fwd))
+	assert.Equal(t, []string{"h1", "h2"}, BalancerOrderHosts("balancer_failover", fwd))
+}
+
+func TestBalancerOrderHosts_Random_AllHostsReturned(t *testing.T) {
+	fwd := &ExpectationForward{Hosts: []string{"h1", "h2", "h3"}, Strategy: BalancerRandom}
+	for i := 0; i < 10; i++ {
+		hosts := BalancerOrderHosts("balancer_random", fwd)
+		assert.Len(t, hosts, 3)
+		assert.Contains(t, hosts, "h1")
+		assert.Contains(t, hosts, "h2")
+		assert.Contains(t, hosts, "h3")
+	}
+}
+
+func TestBalancerReportFailure_MaxFailsReached_HostEjected(t *testing.T) {
+	fwd := &ExpectationForward{Hosts: []string{"h1", "h2"}, Strategy: BalancerFailover, MaxFails: 2}
+
+	BalancerReportFailure("balancer_eject", fwd, "h1")
+	assert.Equal(t, []string{"h1", "h2"}, BalancerOrderHosts("balancer_eject", fwd))
+
+	BalancerReportFailure("balancer_eject", fwd, "h1")
+	assert.Equal(t, []string{"h2", "h1"}, BalancerOrderHosts("balancer_eject", fwd))
+
+	BalancerReportSuccess("balancer_eject", fwd, "h1")
+	assert.Equal(t, []string{"h1", "h2"}, BalancerOrderHosts("balancer_eject", fwd))
+}
+
+func TestBalancerReportFailure_TargetsChanged_StateReset(t *testing.T) {
+	fwd := &ExpectationForward{Hosts: []string{"h1", "h2"}, Strategy: BalancerFailover, MaxFails: 1}
+	BalancerReportFailure("balancer_reset", fwd, "h1")
+	assert.Equal(t, []string{"h2", "h1"}, BalancerOrderHosts("balancer_reset", fwd))
+
+	fwd = &ExpectationForward{Hosts: []string{"h1", "h3"}, Strategy: BalancerFailover, MaxFails: 1}
+	assert.Equal(t, []string{"h1", "h3"}, BalancerOrderHosts("balancer_reset", fwd))
+}
+
+func TestBalancerForget_StateRemoved(t *testing.T) {
+	fwd := &ExpectationForward{Hosts: []string{"h1", "h2"}, Strategy: BalancerRoundRobin}
+	BalancerOrderHosts("balancer_forget", fwd)
+	assert.Equal(t, []string{"h2", "h1"}, BalancerOrderHosts("balancer_forget", fwd))
+
+	BalancerForget("balancer_forget")
+	assert.Equal(t, []string{"h1", "h2"}, BalancerOrderHosts("balancer_forget", fwd))
+	BalancerForget("balancer_forget")
+}
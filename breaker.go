@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// breakerDefaultCoolDown is time in seconds while open circuit serves fallback
+const breakerDefaultCoolDown = 30
+
+// errCircuitOpen is returned for forward requests which aren't sent because circuit is open
+var errCircuitOpen = errors.New("circuit is open, forward target is not called")
+
+// breakerState is circuit breaker state of single forward expectation
+type breakerState struct {
+	failures  int
+	openUntil time.Time
+}
+
+var breakers = map[string]*breakerState{}
+
+var breakersMu sync.Mutex
+
+// ForwardError is diagnostic body of response when forward target is unavailable
+type ForwardError struct {
+	Key     string   `json:"key"`
+	Error   string   `json:"error"`
+	Targets []string `json:"targets"`
+}
+
+// BreakerIsOpen returns true if circuit of expectation is open and forward target shouldn't be called
+func BreakerIsOpen(key string, onError *ExpectationOnError) bool {
+	if onError == nil || onError.Threshold <= 0 {
+		return false
+	}
+
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	state, ok := breakers[key]
+	return ok && time.Now().Before(state.openUntil)
+}
+
+// BreakerReportFailure registers failed forward request. Circuit is opened after threshold of consecutive failures.
+// After cool-down, the next failure opens circuit again
+func BreakerReportFailure(key string, onError *ExpectationOnError) {
+	if onError == nil || onError.Threshold <= 0 {
+		return
+	}
+
+	coolDown := onError.CoolDown
+	if coolDown <= 0 {
+		coolDown = breakerDefaultCoolDown
+	}
+
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	state, ok := breakers[key]
+	if !ok {
+		state = &breakerState{}
+		breakers[key] = state
+	}
+	state.failures++
+	if state.failures >= onError.Threshold {
+		state.openUntil = time.Now().Add(time.Second * coolDown)
+	}
+}
+
+// BreakerReportSuccess closes circuit of expectation
+func BreakerReportSuccess(key string) {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	delete(breakers, key)
+}
+
+// BreakerForget removes circuit state of expectation, it's called when expectation is removed
+func BreakerForget(key string) {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	delete(breakers, key)
+}
+
+// forwardErrorResponse returns fallback response of expectation or response with diagnostic body
+func forwardErrorResponse(key string, fwd *ExpectationForward, err error) *upstreamResponse {
+	if fwd.OnError != nil && fwd.OnError.Response != nil {
+		return upstreamResponseFromExpectation(fwd.OnError.Response)
+	}
+
+	statusCode := http.StatusBadGateway
+	if err == errCircuitOpen {
+		statusCode = http.StatusServiceUnavailable
+	} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		statusCode = http.StatusGatewayTimeout
+	}
+
+	body, _ := json.Marshal(ForwardError{Key: key, Error: err.Error(), Targets: BalancerHosts(fwd)})
+	return &upstreamResponse{
+		StatusCode: statusCode,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Trailer:    http.Header{},
+		Body:       body}
+}
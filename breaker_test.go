@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreakerIsOpen_NoThreshold_NeverOpen(t *testing.T) {
+	BreakerReportFailure("breaker_disabled", &ExpectationOnError{})
+	BreakerReportFailure("breaker_disabled", nil)
+	assert.False(t, BreakerIsOpen("breaker_disabled", &ExpectationOnError{}))
+	assert.False(t, BreakerIsOpen("breaker_disabled", nil))
+}
+
+func TestBreakerIsOpen_ThresholdReached_Open(t *testing.T) {
+	defer BreakerReportSuccess("breaker_open")
+	onError := &ExpectationOnError{Threshold: 2, CoolDown: 10}
+
+	BreakerReportFailure("breaker_open", onError)
+	assert.False(t, BreakerIsOpen("breaker_open", onError))
+	BreakerReportFailure("breaker_open", onError)
+	assert.True(t, BreakerIsOpen("breaker_open", onError))
+
+	BreakerReportSuccess("breaker_open")
+	assert.False(t, BreakerIsOpen("breaker_open", onError))
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestForwardErrorResponse_DiagnosticStatusCodes(t *testing.T) {
+	fwd := &ExpectationForward{Host: "target"}
+
+	resp := forwardErrorResponse("k", fwd, errors.New("connection refused"))
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	forwardError := ForwardError{}
+	assert.NoError(t, json.Unmarshal(resp.Body, &forwardError))
+	assert.Equal(t, ForwardError{Key: "k", Error: "connection refused", Targets: []string{"target"}}, forwardError)
+
+	assert.Equal(t, http.StatusGatewayTimeout, forwardErrorResponse("k", fwd, timeoutError{}).StatusCode)
+	assert.Equal(t, http.StatusServiceUnavailable, forwardErrorResponse("k", fwd, errCircuitOpen).StatusCode)
+}
+
+func TestForwardErrorResponse_Fallback_FallbackResponse(t *testing.T) {
+	fwd := &ExpectationForward{Host: "target", OnError: &ExpectationOnError{
+		Response: &ExpectationResponse{HTTPCode: http.StatusOK, Body: "fallback", Headers: &Headers{"X-Fallback": "1"}}}}
+
+	resp := forwardErrorResponse("k", fwd, errors.New("connection refused"))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "fallback", string(resp.Body))
+	assert.Equal(t, "1", resp.Header.Get("X-Fallback"))
+}
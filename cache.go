@@ -0,0 +1,193 @@
+package main
+
+import (
+	"container/list"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cacheDefaultTTL     = 60
+	cacheDefaultMaxSize = 100
+)
+
+// cacheHeader is added to responses of forward expectations with cache: HIT or MISS
+const cacheHeader = "X-Gozzmock-Cache"
+
+// CacheEntry describes cached response of forward target
+type CacheEntry struct {
+	Key      string    `json:"key"`
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	Headers  Headers   `json:"headers,omitempty"`
+	HTTPCode int       `json:"httpcode"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+	Hits     int       `json:"hits"`
+
+	requestKey string
+	response   *upstreamResponse
+}
+
+// cacheStore is LRU cache of single forward expectation
+type cacheStore struct {
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+var caches = map[string]*cacheStore{}
+
+var cachesMu sync.Mutex
+
+// cacheRequestKey builds cache key from method, path and selected headers
+func cacheRequestKey(req *ExpectationRequest, cache *ExpectationCache) (string, Headers) {
+	headers := Headers{}
+	names := make([]string, 0, len(cache.Headers))
+	for _, name := range cache.Headers {
+		name = http.CanonicalHeaderKey(name)
+		names = append(names, name)
+		if req.Headers != nil {
+			headers[name] = (*req.Headers)[name]
+		}
+	}
+	sort.Strings(names)
+
+	parts := []string{req.Method, req.Path}
+	for _, name := range names {
+		parts = append(parts, name+":"+headers[name])
+	}
+	return strings.Join(parts, "\n"), headers
+}
+
+// CacheGet returns copy of cached response or nil if there is no valid cached response
+func CacheGet(key string, req *ExpectationRequest, cache *ExpectationCache) *upstreamResponse {
+	if cache == nil {
+		return nil
+	}
+	requestKey, _ := cacheRequestKey(req, cache)
+
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+
+	store, ok := caches[key]
+	if !ok {
+		return nil
+	}
+	element, ok := store.entries[requestKey]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(*CacheEntry)
+	if time.Now().After(entry.Expires) {
+		store.order.Remove(element)
+		delete(store.entries, requestKey)
+		return nil
+	}
+
+	entry.Hits++
+	store.order.MoveToFront(element)
+	return cloneUpstreamResponse(entry.response)
+}
+
+// CachePut stores response of forward target. Server errors aren't cached
+func CachePut(key string, req *ExpectationRequest, cache *ExpectationCache, resp *upstreamResponse) {
+	if cache == nil || resp.StatusCode >= http.StatusInternalServerError {
+		return
+	}
+	requestKey, headers := cacheRequestKey(req, cache)
+
+	ttl := cache.TTL
+	if ttl <= 0 {
+		ttl = cacheDefaultTTL
+	}
+	maxSize := cache.MaxSize
+	if maxSize <= 0 {
+		maxSize = cacheDefaultMaxSize
+	}
+
+	now := time.Now()
+	entry := &CacheEntry{
+		Key:      key,
+		Method:   req.Method,
+		Path:     req.Path,
+		Headers:  headers,
+		HTTPCode: resp.StatusCode,
+		Created:  now,
+		Expires:  now.Add(time.Second * ttl),
+
+		requestKey: requestKey,
+		response:   cloneUpstreamResponse(resp)}
+
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+
+	store, ok := caches[key]
+	if !ok {
+		store = &cacheStore{entries: map[string]*list.Element{}, order: list.New()}
+		caches[key] = store
+	}
+	if element, ok := store.entries[requestKey]; ok {
+		store.order.Remove(element)
+	}
+	store.entries[requestKey] = store.order.PushFront(entry)
+
+	for store.order.Len() > maxSize {
+		oldest := store.order.Back()
+		store.order.Remove(oldest)
+		delete(store.entries, oldest.Value.(*CacheEntry).requestKey)
+	}
+}
+
+// CacheGetEntries returns not expired cache entries of expectations in namespace. If key is not empty, only entries
+// of that expectation are returned. Keys of entries are expectation keys without namespace
+func CacheGetEntries(namespace string, key string) []CacheEntry {
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+
+	now := time.Now()
+	entries := []CacheEntry{}
+	for stateKey, store := range caches {
+		expKey, ok := NamespaceKeyOfStateKey(namespace, stateKey)
+		if !ok || (key != "" && key != expKey) {
+			continue
+		}
+		for element := store.order.Front(); element != nil; element = element.Next() {
+			entry := *element.Value.(*CacheEntry)
+			if now.Before(entry.Expires) {
+				entry.Key = expKey
+				entries = append(entries, entry)
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Key != entries[j].Key {
+			return entries[i].Key < entries[j].Key
+		}
+		return entries[i].Created.Before(entries[j].Created)
+	})
+	return entries
+}
+
+// CachePurge removes cached responses of forward state key
+func CachePurge(stateKey string) {
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+
+	delete(caches, stateKey)
+}
+
+// CachePurgeNamespace removes cached responses of expectations in namespace. If key is not empty,
+// only responses of that expectation are removed
+func CachePurgeNamespace(namespace string, key string) {
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+
+	for stateKey := range caches {
+		if expKey, ok := NamespaceKeyOfStateKey(namespace, stateKey); ok && (key == "" || key == expKey) {
+			delete(caches, stateKey)
+		}
+	}
+}
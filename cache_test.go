@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func cacheTestResponse(body string) *upstreamResponse {
+	return &upstreamResponse{StatusCode: http.StatusOK, Header: http.Header{}, Trailer: http.Header{}, Body: []byte(body)}
+}
+
+func TestCacheGet_NoCacheSettings_Nil(t *testing.T) {
+	req := &ExpectationRequest{Method: "GET", Path: "/a"}
+	CachePut("cache_nil", req, nil, cacheTestResponse("a"))
+	assert.Nil(t, CacheGet("cache_nil", req, nil))
+}
+
+func TestCacheGet_SameRequest_CachedCopy(t *testing.T) {
+	defer CachePurge("cache_same")
+	cache := &ExpectationCache{TTL: 10}
+	req := &ExpectationRequest{Method: "GET", Path: "/a"}
+
+	assert.Nil(t, CacheGet("cache_same", req, cache))
+	CachePut("cache_same", req, cache, cacheTestResponse("a"))
+
+	cached := CacheGet("cache_same", req, cache)
+	assert.NotNil(t, cached)
+	assert.Equal(t, "a", string(cached.Body))
+
+	cached.Body[0] = 'b'
+	assert.Equal(t, "a", string(CacheGet("cache_same", req, cache).Body))
+
+	entries := CacheGetEntries("", "cache_same")
+	assert.Len(t, entries, 1)
+	assert.Equal(t, 2, entries[0].Hits)
+
+	assert.Nil(t, CacheGet("cache_same", &ExpectationRequest{Method: "POST", Path: "/a"}, cache))
+	assert.Nil(t, CacheGet("cache_same", &ExpectationRequest{Method: "GET", Path: "/b"}, cache))
+}
+
+func TestCacheGet_SelectedHeaders_PartOfKey(t *testing.T) {
+	defer CachePurge("cache_headers")
+	cache := &ExpectationCache{Headers: []string{"authorization"}}
+	reqUser1 := &ExpectationRequest{Method: "GET", Path: "/a", Headers: &Headers{"Authorization": "user1", "X-Other": "1"}}
+	reqUser2 := &ExpectationRequest{Method: "GET", Path: "/a", Headers: &Headers{"Authorization": "user2", "X-Other": "1"}}
+	reqOther := &ExpectationRequest{Method: "GET", Path: "/a", Headers: &Headers{"Authorization": "user1", "X-Other": "2"}}
+
+	CachePut("cache_headers", reqUser1, cache, cacheTestResponse("user1"))
+	assert.Nil(t, CacheGet("cache_headers", reqUser2, cache))
+	assert.Equal(t, "user1", string(CacheGet("cache_headers", reqOther, cache).Body))
+}
+
+func TestCacheGet_Expired_Nil(t *testing.T) {
+	defer CachePurge("cache_expired")
+	cache := &ExpectationCache{TTL: 10}
+	req := &ExpectationRequest{Method: "GET", Path: "/a"}
+	CachePut("cache_expired", req, cache, cacheTestResponse("a"))
+
+	cachesMu.Lock()
+	for _, element := range caches["cache_expired"].entries {
+		element.Value.(*CacheEntry).Expires = time.Now().Add(-time.Second)
+	}
+	cachesMu.Unlock()
+
+	assert.Empty(t, CacheGetEntries("", "cache_expired"))
+	assert.Nil(t, CacheGet("cache_expired", req, cache))
+}
+
+func TestCachePut_MaxSizeReached_LeastRecentlyUsedEvicted(t *testing.T) {
+	defer CachePurge("cache_lru")
+	cache := &ExpectationCache{MaxSize: 2}
+	reqA := &ExpectationRequest{Method: "GET", Path: "/a"}
+	reqB := &ExpectationRequest{Method: "GET", Path: "/b"}
+	reqC := &ExpectationRequest{Method: "GET", Path: "/c"}
+
+	CachePut("cache_lru", reqA, cache, cacheTestResponse("a"))
+	CachePut("cache_lru", reqB, cache, cacheTestResponse("b"))
+	CacheGet("cache_lru", reqA, cache)
+	CachePut("cache_lru", reqC, cache, cacheTestResponse("c"))
+
+	assert.NotNil(t, CacheGet("cache_lru", reqA, cache))
+	assert.Nil(t, CacheGet("cache_lru", reqB, cache))
+	assert.NotNil(t, CacheGet("cache_lru", reqC, cache))
+}
+
+func TestCachePut_ServerError_NotCached(t *testing.T) {
+	cache := &ExpectationCache{}
+	req := &ExpectationRequest{Method: "GET", Path: "/a"}
+	CachePut("cache_error", req, cache, &upstreamResponse{StatusCode: http.StatusBadGateway, Header: http.Header{}})
+	assert.Nil(t, CacheGet("cache_error", req, cache))
+}
+
+func TestCachePurge_Key_OnlyKeyPurged(t *testing.T) {
+	defer CachePurge("cache_purge2")
+	cache := &ExpectationCache{}
+	req := &ExpectationRequest{Method: "GET", Path: "/a"}
+	CachePut("cache_purge1", req, cache, cacheTestResponse("a"))
+	CachePut("cache_purge2", req, cache, cacheTestResponse("a"))
+
+	CachePurge("cache_purge1")
+	assert.Empty(t, CacheGetEntries("", "cache_purge1"))
+	assert.Len(t, CacheGetEntries("", "cache_purge2"), 1)
+}
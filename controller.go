@@ -6,53 +6,243 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"regexp"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/rs/zerolog/log"
 )
 
-var expectations Expectations
+// store keeps Store of default namespace, it's read without locking
+var store atomic.Value
 
+// mu serializes changes of expectations which read and write store, like reset or update
 var mu sync.Mutex
 
-// ControllerGetExpectations returns list with expectations in concurrent mode
-func ControllerGetExpectations(expsInjection Expectations) Expectations {
-	if expsInjection != nil {
-		return expsInjection
+func init() {
+	store.Store(storeHolder{NewMemoryStore()})
+}
+
+// storeHolder wraps Store, so stores of different types can be kept in atomic.Value
+type storeHolder struct {
+	Store
+}
+
+// ControllerSetStore sets store of default namespace. Previous store isn't closed
+func ControllerSetStore(s Store) {
+	store.Store(storeHolder{s})
+}
+
+// ControllerGetStore returns storeInjection or store of default namespace if storeInjection is nil
+func ControllerGetStore(storeInjection Store) Store {
+	if storeInjection != nil {
+		return storeInjection
+	}
+	return store.Load().(storeHolder).Store
+}
+
+// controllerStoreError wraps error of store write to be returned by admin API
+func controllerStoreError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return APIInternal("can't save expectations: " + err.Error())
+}
+
+// controllerForgetForwardState removes cached responses, balancer and circuit breaker state of removed or replaced
+// expectations, so state of previous targets isn't used by expectation added with the same key
+func controllerForgetForwardState(storeInjection Store, keys []string) {
+	namespace, ok := NamespaceOfStore(storeInjection)
+	if !ok {
+		return
+	}
+	for _, key := range keys {
+		forwardForgetState(NamespaceStateKey(namespace, key))
+	}
+}
+
+// controllerChangedKeys returns keys of put expectations followed by removed keys
+func controllerChangedKeys(put []Expectation, keys []string) []string {
+	changed := make([]string, 0, len(put)+len(keys))
+	for _, exp := range put {
+		changed = append(changed, exp.Key)
+	}
+	return append(changed, keys...)
+}
+
+// ControllerGetExpectations returns copy of expectations
+func ControllerGetExpectations(storeInjection Store) Expectations {
+	return ControllerGetStore(storeInjection).List()
+}
+
+// ControllerMatchExpectation returns expectation with the highest priority which request passes.
+// Expectations with the same priority are checked in order of keys
+func ControllerMatchExpectation(req *ExpectationRequest, storeInjection Store) (Expectation, bool) {
+	return ControllerGetStore(storeInjection).Index().Match(req)
+}
+
+// ControllerGetSnapshot returns consistent view of expectations for matching without locking and copying.
+// Snapshot isn't changed by later changes of expectations and must not be changed by caller
+func ControllerGetSnapshot(storeInjection Store) Expectations {
+	return ControllerGetStore(storeInjection).Snapshot()
+}
+
+// ControllerAddExpectation adds new expectation to store. If expectation with same key exists, updates it
+func ControllerAddExpectation(key string, exp Expectation, storeInjection Store) (Expectations, error) {
+	var s = ControllerGetStore(storeInjection)
+	mu.Lock()
+	defer mu.Unlock()
+
+	exp.Key = key
+	if err := s.Put(exp); err != nil {
+		return nil, controllerStoreError(err)
 	}
+	controllerForgetForwardState(storeInjection, []string{key})
+	return s.List(), nil
+}
 
+// ControllerRemoveExpectation removes expectation with particular key
+func ControllerRemoveExpectation(key string, storeInjection Store) (Expectations, error) {
+	var s = ControllerGetStore(storeInjection)
 	mu.Lock()
 	defer mu.Unlock()
 
-	if expectations == nil {
-		expectations = make(Expectations)
+	if err := s.Delete(key); err != nil {
+		return nil, controllerStoreError(err)
 	}
-	return expectations
+	controllerForgetForwardState(storeInjection, []string{key})
+	return s.List(), nil
 }
 
-// ControllerAddExpectation adds new expectation to list. If expectation with same key exists, updates it
-func ControllerAddExpectation(key string, exp Expectation, expsInjection Expectations) Expectations {
-	var exps = ControllerGetExpectations(expsInjection)
+// ControllerAddExpectations adds list of expectations at once. Expectations with the same keys are updated.
+// If reset is true, all other expectations are removed in the same change
+func ControllerAddExpectations(newExps []Expectation, reset bool, storeInjection Store) (Expectations, error) {
+	var s = ControllerGetStore(storeInjection)
 	mu.Lock()
 	defer mu.Unlock()
 
-	exps[key] = exp
-	return exps
+	stale := []string{}
+	if reset {
+		added := map[string]bool{}
+		for _, exp := range newExps {
+			added[exp.Key] = true
+		}
+		for key := range s.Snapshot() {
+			if !added[key] {
+				stale = append(stale, key)
+			}
+		}
+		sort.Strings(stale)
+	}
+	if err := s.Change(newExps, stale); err != nil {
+		return nil, controllerStoreError(err)
+	}
+	controllerForgetForwardState(storeInjection, controllerChangedKeys(newExps, stale))
+	return s.List(), nil
 }
 
-// ControllerRemoveExpectation removes expectation with particular key
-func ControllerRemoveExpectation(key string, expsInjection Expectations) Expectations {
-	var exps = ControllerGetExpectations(expsInjection)
+// ControllerChangeExpectations adds or updates expectations and removes expectations with keys at once.
+// If change can't be saved, expectations aren't changed
+func ControllerChangeExpectations(put []Expectation, keys []string, storeInjection Store) (Expectations, error) {
+	var s = ControllerGetStore(storeInjection)
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := s.Change(put, keys); err != nil {
+		return nil, controllerStoreError(err)
+	}
+	controllerForgetForwardState(storeInjection, controllerChangedKeys(put, keys))
+	return s.List(), nil
+}
+
+// ControllerResetExpectations removes all expectations
+func ControllerResetExpectations(storeInjection Store) (Expectations, error) {
+	return ControllerAddExpectations(nil, true, storeInjection)
+}
+
+// ControllerRemoveExpectations removes expectations which keys pass filter and labels match selector.
+// Key filter is a regex or substring like in request filters, empty filter matches all keys. Returns removed keys in sorted order
+func ControllerRemoveExpectations(keyFilter string, selector LabelSelector, storeInjection Store) ([]string, error) {
+	var s = ControllerGetStore(storeInjection)
+	mu.Lock()
+	defer mu.Unlock()
+
+	removed := []string{}
+	for key, exp := range s.Snapshot() {
+		if (keyFilter == "" || ControllerStringPassesFilter(key, keyFilter)) && selector.Matches(exp.Labels) {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(removed)
+	if err := s.Delete(removed...); err != nil {
+		return nil, controllerStoreError(err)
+	}
+	controllerForgetForwardState(storeInjection, removed)
+	return removed, nil
+}
+
+// ControllerGetExpectation returns expectation with particular key
+func ControllerGetExpectation(key string, storeInjection Store) (Expectation, bool) {
+	return ControllerGetStore(storeInjection).Get(key)
+}
+
+// ControllerUpdateExpectation atomically changes expectation with particular key. Update gets current expectation
+// or nil and returns new expectation or nil to remove it. If update returns error, expectations aren't changed
+func ControllerUpdateExpectation(key string, update func(current *Expectation) (*Expectation, error), storeInjection Store) (*Expectation, error) {
+	var s = ControllerGetStore(storeInjection)
 	mu.Lock()
 	defer mu.Unlock()
 
-	if _, ok := exps[key]; ok {
-		delete(exps, key)
+	var current *Expectation
+	if exp, ok := s.Get(key); ok {
+		current = &exp
+	}
+	updated, err := update(current)
+	if err != nil {
+		return nil, err
 	}
-	return exps
+	if updated == nil {
+		if err = s.Delete(key); err != nil {
+			return nil, controllerStoreError(err)
+		}
+		controllerForgetForwardState(storeInjection, []string{key})
+		return nil, nil
+	}
+	updated.Key = key
+	if err = s.Put(*updated); err != nil {
+		return nil, controllerStoreError(err)
+	}
+	controllerForgetForwardState(storeInjection, []string{key})
+	return updated, nil
+}
+
+// ControllerListExpectations returns page of expectations which keys pass filter and labels match selector, sorted by key,
+// and total number of them
+func ControllerListExpectations(keyFilter string, selector LabelSelector, offset int, limit int, storeInjection Store) ([]Expectation, int) {
+	var exps = ControllerGetSnapshot(storeInjection)
+	keys := make([]string, 0, len(exps))
+	for key, exp := range exps {
+		if (keyFilter == "" || ControllerStringPassesFilter(key, keyFilter)) && selector.Matches(exp.Labels) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	total := len(keys)
+	if offset > total {
+		offset = total
+	}
+	keys = keys[offset:]
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	page := make([]Expectation, 0, len(keys))
+	for _, key := range keys {
+		page = append(page, exps[key])
+	}
+
+	return page, total
 }
 
 // ControllerTranslateHTTPHeadersToExpHeaders translates http headers into custom headers map
@@ -68,8 +258,22 @@ func ControllerTranslateHTTPHeadersToExpHeaders(httpHeader http.Header) *Headers
 func ControllerTranslateRequestToExpectation(r *http.Request) *ExpectationRequest {
 	var expRequest = ExpectationRequest{}
 	expRequest.Method = r.Method
+	expRequest.Host = r.Host
+	expRequest.namespace = r.Header.Get(namespaceHeader)
 	expRequest.Path = r.URL.RequestURI()
 
+	// request in absolute-form is sent to gozzmock as to HTTP proxy
+	if r.URL.IsAbs() {
+		expRequest.proxied = true
+		expRequest.URL = fmt.Sprintf("%s://%s%s", r.URL.Scheme, r.URL.Host, expRequest.Path)
+	} else {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		expRequest.URL = fmt.Sprintf("%s://%s%s", scheme, r.Host, expRequest.Path)
+	}
+
 	if len(r.URL.Fragment) > 0 {
 		expRequest.Path += "#" + r.URL.Fragment
 	}
@@ -91,69 +295,110 @@ func ControllerTranslateRequestToExpectation(r *http.Request) *ExpectationReques
 
 // ControllerStringPassesFilter validates whether the input string has filter string as substring or as a regex
 func ControllerStringPassesFilter(str string, filter string) bool {
-	r, error := regexp.Compile("(?s)" + filter)
-	if error != nil {
-		return strings.Contains(str, filter)
-	}
-	return r.Match([]byte(str))
+	return CompileStringMatcher(filter).Matches(str)
 }
 
-// ControllerRequestPassesFilter validates whether the incoming request passes particular filter
-func ControllerRequestPassesFilter(req *ExpectationRequest, storedExpectation *ExpectationRequest) bool {
-	fLog := log.With().Str("function", "ControllerRequestPassesFilter").Logger()
+// FilterMismatch explains why request doesn't pass filter of particular field
+type FilterMismatch struct {
+	Field    string `json:"field"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Reason   string `json:"reason"`
+}
 
+// ControllerRequestMismatches returns all fields of request which don't pass filter and number of checked fields
+func ControllerRequestMismatches(req *ExpectationRequest, storedExpectation *ExpectationRequest) ([]FilterMismatch, int) {
+	mismatches := []FilterMismatch{}
 	if storedExpectation == nil {
-		fLog.Debug().Msg("Stored expectation.request is nil")
-		return true
+		return mismatches, 0
 	}
+	checked := 0
 
-	if len(storedExpectation.Method) > 0 && storedExpectation.Method != req.Method {
-		fLog.Info().Msgf("method %s should be %s", req.Method, storedExpectation.Method)
-		return false
+	stringFilters := []struct {
+		field  string
+		value  string
+		filter string
+	}{
+		{"host", req.Host, storedExpectation.Host},
+		{"url", req.URL, storedExpectation.URL},
+		{"path", req.Path, storedExpectation.Path},
+		{"body", req.Body, storedExpectation.Body},
 	}
 
-	if len(storedExpectation.Path) > 0 && !ControllerStringPassesFilter(req.Path, storedExpectation.Path) {
-		fLog.Info().Msgf("path %s doesn't pass filter %s", req.Path, storedExpectation.Path)
-		return false
+	if len(storedExpectation.Method) > 0 {
+		checked++
+		if storedExpectation.Method != req.Method {
+			mismatches = append(mismatches, FilterMismatch{
+				Field:    "method",
+				Expected: storedExpectation.Method,
+				Actual:   req.Method,
+				Reason:   fmt.Sprintf("method %s should be %s", req.Method, storedExpectation.Method)})
+		}
 	}
 
-	if len(storedExpectation.Body) > 0 && !ControllerStringPassesFilter(req.Body, storedExpectation.Body) {
-		fLog.Info().Msgf("body %s doesn't pass filter %s", req.Body, storedExpectation.Body)
-		return false
+	for _, f := range stringFilters {
+		if len(f.filter) == 0 {
+			continue
+		}
+		checked++
+		if !ControllerStringPassesFilter(f.value, f.filter) {
+			mismatches = append(mismatches, FilterMismatch{
+				Field:    f.field,
+				Expected: f.filter,
+				Actual:   f.value,
+				Reason:   fmt.Sprintf("%s %s doesn't pass filter %s", f.field, f.value, f.filter)})
+		}
 	}
 
 	if storedExpectation.Headers != nil {
-		if req.Headers == nil {
-			fLog.Info().Msgf("Request is expected to contain headers")
-			return false
+		names := make([]string, 0, len(*storedExpectation.Headers))
+		for name := range *storedExpectation.Headers {
+			names = append(names, name)
 		}
-		for storedHeaderName, storedHeaderValue := range *storedExpectation.Headers {
-			value, ok := (*req.Headers)[storedHeaderName]
+		sort.Strings(names)
+
+		for _, storedHeaderName := range names {
+			storedHeaderValue := (*storedExpectation.Headers)[storedHeaderName]
+			checked++
+			value, ok := "", false
+			if req.Headers != nil {
+				value, ok = (*req.Headers)[storedHeaderName]
+			}
 			if !ok {
-				fLog.Info().Msgf("No header %s in the request headers %v", storedHeaderName, req.Headers)
-				return false
+				mismatches = append(mismatches, FilterMismatch{
+					Field:    "header." + storedHeaderName,
+					Expected: storedHeaderValue,
+					Reason:   fmt.Sprintf("No header %s in the request headers %v", storedHeaderName, req.Headers)})
+				continue
 			}
 			if !ControllerStringPassesFilter(value, storedHeaderValue) {
-				fLog.Info().Msgf("header %s:%s has been rejected. Expected header value %s", storedHeaderName, value, storedHeaderValue)
-				return false
+				mismatches = append(mismatches, FilterMismatch{
+					Field:    "header." + storedHeaderName,
+					Expected: storedHeaderValue,
+					Actual:   value,
+					Reason:   fmt.Sprintf("header %s:%s has been rejected. Expected header value %s", storedHeaderName, value, storedHeaderValue)})
 			}
 		}
 	}
 
-	return true
+	return mismatches, checked
 }
 
-// ControllerSortExpectationsByPriority returns map with int keys sorted by priority DESC.
-// 0-indexed element has the highest priority
-func ControllerSortExpectationsByPriority(exps Expectations) ExpectationsInt {
-	listForSorting := ExpectationsInt{}
-	i := 0
-	for _, exp := range exps {
-		listForSorting[i] = exp
-		i++
+// ControllerRequestPassesFilter validates whether the incoming request passes particular filter
+func ControllerRequestPassesFilter(req *ExpectationRequest, storedExpectation *ExpectationRequest) bool {
+	fLog := log.With().Str("function", "ControllerRequestPassesFilter").Logger()
+
+	if storedExpectation == nil {
+		fLog.Debug().Msg("Stored expectation.request is nil")
+		return true
+	}
+
+	mismatches, _ := ControllerRequestMismatches(req, storedExpectation)
+	if len(mismatches) > 0 {
+		fLog.Info().Msg(mismatches[0].Reason)
+		return false
 	}
-	sort.Sort(listForSorting)
-	return listForSorting
+	return true
 }
 
 // ControllerCreateHTTPRequest creates an http request based on incoming request and forward rules
@@ -162,13 +407,13 @@ func ControllerCreateHTTPRequest(req *ExpectationRequest, fwd *ExpectationForwar
 
 	fwdURL, err := url.Parse(fmt.Sprintf("%s://%s%s", fwd.Scheme, fwd.Host, req.Path))
 	if err != nil {
-		fLog.Panic().Err(err)
+		fLog.Error().Err(err).Msg("Can't create URL of forward target")
 		return nil
 	}
 	fLog.Info().Msgf("Send request to %s", fwdURL)
 	httpReq, err := http.NewRequest(req.Method, fwdURL.String(), bytes.NewBuffer([]byte(req.Body)))
 	if err != nil {
-		fLog.Panic().Err(err)
+		fLog.Error().Err(err).Msg("Can't create request to forward target")
 		return nil
 	}
 
@@ -177,6 +422,11 @@ func ControllerCreateHTTPRequest(req *ExpectationRequest, fwd *ExpectationForwar
 			httpReq.Header.Set(name, value)
 		}
 	}
+	for _, name := range hopByHopHeaders {
+		httpReq.Header.Del(name)
+	}
+	httpReq.Header.Del("Proxy-Connection")
+	httpReq.Header.Del(namespaceHeader)
 
 	if fwd.Headers != nil {
 		for name, value := range *fwd.Headers {
@@ -3,21 +3,25 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestControllerGetExpectations_NoExpectations_ReturnEmptyList(t *testing.T) {
-	var exps = ControllerGetExpectations(Expectations{})
+	var exps = ControllerGetExpectations(NewMemoryStore())
 	assert.Empty(t, exps)
 }
 
 func TestControllerAddExpectations_NoExpectations_ReturnOneItem(t *testing.T) {
 	var exp = Expectation{Key: "k"}
 
-	var exps = ControllerAddExpectation(exp.Key, exp, Expectations{})
+	exps, err := ControllerAddExpectation(exp.Key, exp, NewMemoryStore())
+	assert.NoError(t, err)
 	assert.Contains(t, exps, exp.Key)
 	assert.Equal(t, exp, exps[exp.Key])
 }
@@ -25,11 +29,12 @@ func TestControllerAddExpectations_NoExpectations_ReturnOneItem(t *testing.T) {
 func TestControllerAddExpectations_ExistingKey_ReturnUpdatedOneItem(t *testing.T) {
 	var exp1 = Expectation{Key: "k", Delay: 1}
 	var exp2 = Expectation{Key: "k", Delay: 2}
+	s := NewMemoryStore()
 
-	var exps = ControllerAddExpectation(exp1.Key, exp1, Expectations{})
+	exps, _ := ControllerAddExpectation(exp1.Key, exp1, s)
 	assert.Contains(t, exps, exp1.Key)
 
-	exps = ControllerAddExpectation(exp2.Key, exp2, exps)
+	exps, _ = ControllerAddExpectation(exp2.Key, exp2, s)
 	assert.Contains(t, exps, exp2.Key)
 	assert.Equal(t, 1, len(exps))
 	assert.Equal(t, exp2, exps[exp2.Key])
@@ -38,11 +43,12 @@ func TestControllerAddExpectations_ExistingKey_ReturnUpdatedOneItem(t *testing.T
 func TestControllerAddExpectations_NewKey_ReturnTwoItems(t *testing.T) {
 	var exp1 = Expectation{Key: "k1", Delay: 1}
 	var exp2 = Expectation{Key: "k2", Delay: 2}
+	s := NewMemoryStore()
 
-	var exps = ControllerAddExpectation(exp1.Key, exp1, Expectations{})
+	exps, _ := ControllerAddExpectation(exp1.Key, exp1, s)
 	assert.Contains(t, exps, exp1.Key)
 
-	exps = ControllerAddExpectation(exp2.Key, exp2, exps)
+	exps, _ = ControllerAddExpectation(exp2.Key, exp2, s)
 	assert.Contains(t, exps, exp2.Key)
 
 	assert.Equal(t, 2, len(exps))
@@ -52,24 +58,139 @@ func TestControllerAddExpectations_NewKey_ReturnTwoItems(t *testing.T) {
 
 func TestControllerRemoveExpectations_OneExpectations_ReturnEmptyList(t *testing.T) {
 	var exp = Expectation{Key: "k"}
+	s := NewMemoryStore()
 
-	var exps = ControllerAddExpectation(exp.Key, exp, Expectations{})
+	exps, _ := ControllerAddExpectation(exp.Key, exp, s)
 	assert.Contains(t, exps, exp.Key)
 
-	exps = ControllerRemoveExpectation(exp.Key, exps)
+	exps, err := ControllerRemoveExpectation(exp.Key, s)
+	assert.NoError(t, err)
 	assert.Empty(t, exps)
 }
 
 func TestControllerRemoveWrongKeyExpectations_OneExpectations_NotReturnError(t *testing.T) {
 	var exp = Expectation{Key: "k"}
+	s := NewMemoryStore()
 
-	var exps = ControllerAddExpectation(exp.Key, exp, Expectations{})
+	exps, _ := ControllerAddExpectation(exp.Key, exp, s)
 	assert.Contains(t, exps, exp.Key)
 
-	exps = ControllerRemoveExpectation("wrong_key", exps)
+	exps, err := ControllerRemoveExpectation("wrong_key", s)
+	assert.NoError(t, err)
 	assert.Contains(t, exps, exp.Key)
 }
 
+func TestControllerAddExpectationsBulk_ExistingKey_AddedAndUpdated(t *testing.T) {
+	s := newTestStore(Expectation{Key: "k1", Delay: 1}, Expectation{Key: "k3"})
+
+	exps, err := ControllerAddExpectations([]Expectation{{Key: "k1", Delay: 2}, {Key: "k2"}}, false, s)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(exps))
+	assert.Equal(t, Expectation{Key: "k1", Delay: 2}, exps["k1"])
+	assert.Contains(t, exps, "k2")
+}
+
+func TestControllerAddExpectationsBulk_Reset_OnlyNewExpectations(t *testing.T) {
+	s := newTestStore(Expectation{Key: "k1"}, Expectation{Key: "k3"})
+
+	exps, err := ControllerAddExpectations([]Expectation{{Key: "k1"}, {Key: "k2"}}, true, s)
+	assert.NoError(t, err)
+	assert.Equal(t, Expectations{"k1": Expectation{Key: "k1"}, "k2": Expectation{Key: "k2"}}, exps)
+}
+
+func TestControllerResetExpectations_ReturnEmptyList(t *testing.T) {
+	s := newTestStore(Expectation{Key: "k1"})
+	exps, err := ControllerResetExpectations(s)
+	assert.NoError(t, err)
+	assert.Empty(t, exps)
+	assert.Empty(t, s.List())
+}
+
+func TestControllerRemoveExpectationsByFilter_ReturnRemovedKeys(t *testing.T) {
+	s := newTestStore(Expectation{Key: "suite1_login"}, Expectation{Key: "suite1_cart"}, Expectation{Key: "suite2_login"})
+
+	removed, err := ControllerRemoveExpectations("^suite1_", nil, s)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"suite1_cart", "suite1_login"}, removed)
+	assert.Equal(t, 1, len(s.List()))
+	assert.Contains(t, s.List(), "suite2_login")
+
+	removed, _ = ControllerRemoveExpectations("suite3", nil, s)
+	assert.Empty(t, removed)
+}
+
+func TestControllerListExpectations_Paging_SortedByKey(t *testing.T) {
+	s := newTestStore(Expectation{Key: "c"}, Expectation{Key: "a"}, Expectation{Key: "b"}, Expectation{Key: "x_a"})
+
+	page, total := ControllerListExpectations("", nil, 1, 2, s)
+	assert.Equal(t, 4, total)
+	assert.Equal(t, []Expectation{{Key: "b"}, {Key: "c"}}, page)
+
+	page, total = ControllerListExpectations("^x_", nil, 0, 0, s)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, []Expectation{{Key: "x_a"}}, page)
+
+	page, total = ControllerListExpectations("", nil, 10, 2, s)
+	assert.Equal(t, 4, total)
+	assert.Empty(t, page)
+}
+
+func TestControllerListAndRemoveExpectations_LabelSelector(t *testing.T) {
+	s := newTestStore(
+		Expectation{Key: "a", Labels: map[string]string{"suite": "checkout"}},
+		Expectation{Key: "b", Labels: map[string]string{"suite": "login"}},
+		Expectation{Key: "c"})
+	selector, err := ParseLabelSelector("suite=checkout")
+	assert.NoError(t, err)
+
+	page, total := ControllerListExpectations("", selector, 0, 0, s)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, "a", page[0].Key)
+
+	selector, err = ParseLabelSelector("suite")
+	assert.NoError(t, err)
+	removed, err := ControllerRemoveExpectations("", selector, s)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, removed)
+	assert.Equal(t, 1, len(s.List()))
+	assert.Contains(t, s.List(), "c")
+}
+
+func TestControllerUpdateExpectation_CreateUpdateRemove(t *testing.T) {
+	s := NewMemoryStore()
+
+	exp, err := ControllerUpdateExpectation("k", func(current *Expectation) (*Expectation, error) {
+		assert.Nil(t, current)
+		return &Expectation{Key: "k", Delay: 1}, nil
+	}, s)
+	assert.NoError(t, err)
+	assert.Equal(t, &Expectation{Key: "k", Delay: 1}, exp)
+
+	_, err = ControllerUpdateExpectation("k", func(current *Expectation) (*Expectation, error) {
+		return nil, fmt.Errorf("precondition failed")
+	}, s)
+	assert.Error(t, err)
+	assert.Equal(t, Expectation{Key: "k", Delay: 1}, s.List()["k"])
+
+	exp, err = ControllerUpdateExpectation("k", func(current *Expectation) (*Expectation, error) {
+		assert.Equal(t, time.Duration(1), current.Delay)
+		return nil, nil
+	}, s)
+	assert.NoError(t, err)
+	assert.Nil(t, exp)
+	assert.Empty(t, s.List())
+
+	_, ok := ControllerGetExpectation("k", s)
+	assert.False(t, ok)
+}
+
+func TestControllerAddExpectation_StoreFails_InternalError(t *testing.T) {
+	_, err := ControllerAddExpectation("k", Expectation{Key: "k"}, failingStore{NewMemoryStore()})
+	apiErr, ok := err.(*APIError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusInternalServerError, apiErr.Status)
+}
+
 func TestControllerTranslateRequestToExpectation_SimpleRequest_AllFieldsTranslated(t *testing.T) {
 	request, err := http.NewRequest("POST", "https://www.host.com/a/b?foo=bar#fr", strings.NewReader("body text"))
 	if err != nil {
@@ -184,25 +305,6 @@ func TestControllerRequestPassFilter_BodysEq_True(t *testing.T) {
 		&ExpectationRequest{Body: "body"}))
 }
 
-func TestControllerSortExpectationsByPriority_EmptyExps_OK(t *testing.T) {
-	sortedMap := ControllerSortExpectationsByPriority(Expectations{})
-	assert.Equal(t, 0, len(sortedMap))
-}
-
-func TestControllerSortExpectationsByPriority_ListOfExpectations_OK(t *testing.T) {
-	exp1 := Expectation{Key: "k1", Priority: 1}
-	exp2 := Expectation{Key: "k0", Priority: 0}
-	exp3 := Expectation{Key: "k2", Priority: 2}
-	exps := ControllerAddExpectation(exp1.Key, exp1, Expectations{})
-	exps = ControllerAddExpectation(exp2.Key, exp2, exps)
-	exps = ControllerAddExpectation(exp3.Key, exp3, exps)
-	sortedMap := ControllerSortExpectationsByPriority(exps)
-	assert.Equal(t, 3, len(sortedMap))
-	assert.Equal(t, "k2", sortedMap[0].Key)
-	assert.Equal(t, "k1", sortedMap[1].Key)
-	assert.Equal(t, "k0", sortedMap[2].Key)
-}
-
 func TestControllerControllerCreateHTTPRequestWithHeaders(t *testing.T) {
 	expReq := &ExpectationRequest{Method: "GET", Path: "/request", Headers: &Headers{"h_req": "hv_req"}}
 	expFwd := &ExpectationForward{Scheme: "https", Host: "localhost_fwd", Headers: &Headers{"h_req": "hv_fwd", "h_fwd": "hv_fwd"}}
@@ -214,3 +316,155 @@ func TestControllerControllerCreateHTTPRequestWithHeaders(t *testing.T) {
 	assert.Equal(t, "hv_fwd", httpReq.Header.Get("h_req"))
 	assert.Equal(t, "hv_fwd", httpReq.Header.Get("h_fwd"))
 }
+
+func TestControllerTranslateRequestToExpectation_OriginForm_URLFromHost(t *testing.T) {
+	request, err := http.NewRequest("GET", "/a?b=c", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Host = "www.host.com:8080"
+
+	exp := ControllerTranslateRequestToExpectation(request)
+	assert.Equal(t, "www.host.com:8080", exp.Host)
+	assert.Equal(t, "http://www.host.com:8080/a?b=c", exp.URL)
+	assert.False(t, exp.proxied)
+}
+
+func TestControllerTranslateRequestToExpectation_AbsoluteForm_Proxied(t *testing.T) {
+	request, err := http.NewRequest("GET", "https://www.host.com/a?b=c", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := ControllerTranslateRequestToExpectation(request)
+	assert.Equal(t, "https://www.host.com/a?b=c", exp.URL)
+	assert.True(t, exp.proxied)
+}
+
+func TestControllerRequestPassFilter_HostAndURL(t *testing.T) {
+	req := &ExpectationRequest{Host: "api.host.com", URL: "https://api.host.com/a"}
+	assert.True(t, ControllerRequestPassesFilter(req, &ExpectationRequest{Host: "api", URL: "^https://api.host.com/"}))
+	assert.False(t, ControllerRequestPassesFilter(req, &ExpectationRequest{Host: "other"}))
+	assert.False(t, ControllerRequestPassesFilter(req, &ExpectationRequest{URL: "^http://"}))
+}
+
+func TestControllerCreateHTTPRequest_HopByHopHeaders_Removed(t *testing.T) {
+	expReq := &ExpectationRequest{Method: "GET", Path: "/", Headers: &Headers{"Proxy-Connection": "keep-alive", "Connection": "close", "H": "v"}}
+	httpReq := ControllerCreateHTTPRequest(expReq, &ExpectationForward{Scheme: "http", Host: "localhost"})
+	assert.Empty(t, httpReq.Header.Get("Proxy-Connection"))
+	assert.Empty(t, httpReq.Header.Get("Connection"))
+	assert.Equal(t, "v", httpReq.Header.Get("H"))
+}
+
+func TestControllerRequestMismatches_AllFieldsReported(t *testing.T) {
+	mismatches, checked := ControllerRequestMismatches(
+		&ExpectationRequest{Method: "GET", Path: "/a", Body: "b", Headers: &Headers{"H1": "v1"}},
+		&ExpectationRequest{Method: "POST", Path: "/a", Body: "x", Headers: &Headers{"H1": "v2", "H2": "v"}})
+
+	assert.Equal(t, 5, checked)
+	fields := []string{}
+	for _, mismatch := range mismatches {
+		fields = append(fields, mismatch.Field)
+	}
+	assert.Equal(t, []string{"method", "body", "header.H1", "header.H2"}, fields)
+	assert.Equal(t, "method GET should be POST", mismatches[0].Reason)
+	assert.Equal(t, "v1", mismatches[2].Actual)
+	assert.Equal(t, "v2", mismatches[2].Expected)
+}
+
+func TestControllerRequestMismatches_NilFilter_NoMismatches(t *testing.T) {
+	mismatches, checked := ControllerRequestMismatches(&ExpectationRequest{Method: "GET"}, nil)
+	assert.Empty(t, mismatches)
+	assert.Equal(t, 0, checked)
+}
+
+func TestController_ConcurrentAddRemoveMatch_NoRace(t *testing.T) {
+	previous := ControllerGetStore(nil)
+	defer ControllerSetStore(previous)
+	ControllerSetStore(NewMemoryStore())
+	defer JournalReset()
+
+	const workers = 4
+	const iterations = 100
+	var wg sync.WaitGroup
+	run := func(f func(worker int, i int)) {
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(worker int) {
+				defer wg.Done()
+				for i := 0; i < iterations; i++ {
+					f(worker, i)
+				}
+			}(w)
+		}
+	}
+
+	run(func(worker int, i int) {
+		key := fmt.Sprintf("race_%d_%d", worker, i%10)
+		exp := Expectation{Key: key, Priority: i, Request: &ExpectationRequest{Path: "/race"}, Response: &ExpectationResponse{HTTPCode: 200, Body: key}}
+		ControllerAddExpectation(key, exp, nil)
+		if i%3 == 0 {
+			ControllerRemoveExpectation(key, nil)
+		}
+	})
+	run(func(worker int, i int) {
+		ControllerUpdateExpectation(fmt.Sprintf("race_%d_0", worker), func(current *Expectation) (*Expectation, error) {
+			if current == nil {
+				return nil, nil
+			}
+			updated := *current
+			updated.Priority++
+			return &updated, nil
+		}, nil)
+		ControllerRemoveExpectations(fmt.Sprintf("race_%d_9", worker), nil, nil)
+	})
+	run(func(worker int, i int) {
+		w := httptest.NewRecorder()
+		HandlerDefault(w, httptest.NewRequest("GET", "/race", nil))
+		if w.Code != http.StatusOK && w.Code != http.StatusNotImplemented {
+			t.Errorf("unexpected response code %d", w.Code)
+		}
+		HandlerGetExpectations(httptest.NewRecorder(), httptest.NewRequest("GET", "/gozzmock/get_expectations", nil))
+		ControllerListExpectations("race", nil, 0, 10, nil)
+	})
+	run(func(worker int, i int) {
+		name := fmt.Sprintf("race_ns_%d", worker)
+		NamespaceCreate(name)
+		nsStore, _ := NamespaceStore(name)
+		if nsStore != nil {
+			ControllerAddExpectation("ns", Expectation{Response: &ExpectationResponse{HTTPCode: 200}}, nsStore)
+		}
+		r := httptest.NewRequest("GET", "/race", nil)
+		r.Header.Set(namespaceHeader, name)
+		HandlerDefault(httptest.NewRecorder(), r)
+		NamespaceList()
+		NamespaceDelete(name)
+	})
+	wg.Wait()
+}
+
+func TestControllerGetSnapshot_ConcurrentBulkChanges_ConsistentView(t *testing.T) {
+	s := NewMemoryStore()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			ControllerAddExpectations([]Expectation{{Key: "pair_a", Priority: i}, {Key: "pair_b", Priority: i}}, false, s)
+			ControllerRemoveExpectations("^pair_", nil, s)
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		snapshot := ControllerGetSnapshot(s)
+		a, okA := snapshot["pair_a"]
+		b, okB := snapshot["pair_b"]
+		if okA != okB || a.Priority != b.Priority {
+			t.Fatalf("snapshot isn't consistent: %v %v", a, b)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const expectationFilesDefaultInterval = 2 * time.Second
+
+// ExpectationFiles loads expectations from JSON files and directories and keeps them in sync with controller.
+// File contains array of expectations or one expectation. Directories are scanned for *.json files, not recursively.
+// Only keys loaded from files are changed on reload. Expectation added by API with the same key as file expectation
+// is replaced by it and removed when key is removed from file
+type ExpectationFiles struct {
+	files          []string
+	dirs           []string
+	storeInjection Store
+	mu             sync.Mutex
+	fingerprint    string
+	loaded         map[string]Expectation
+}
+
+// ExpectationFilesOpen creates loader for files and directories. Nothing is loaded until Reload is called
+func ExpectationFilesOpen(files []string, dirs []string, storeInjection Store) *ExpectationFiles {
+	return &ExpectationFiles{
+		files:          files,
+		dirs:           dirs,
+		storeInjection: storeInjection,
+		loaded:         map[string]Expectation{}}
+}
+
+// paths returns sorted list of files to load: explicit files and *.json files of directories
+func (f *ExpectationFiles) paths() ([]string, error) {
+	paths := []string{}
+	for _, file := range f.files {
+		ext := strings.ToLower(filepath.Ext(file))
+		if ext == ".yaml" || ext == ".yml" {
+			return nil, fmt.Errorf("%s: YAML isn't supported, use JSON", file)
+		}
+		paths = append(paths, file)
+	}
+	for _, dir := range f.dirs {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			if !info.IsDir() && strings.ToLower(filepath.Ext(info.Name())) == ".json" {
+				paths = append(paths, filepath.Join(dir, info.Name()))
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// stat returns fingerprint of files: paths, sizes and modification times. Reload is skipped when it isn't changed
+func (f *ExpectationFiles) stat(paths []string) (string, error) {
+	var fingerprint bytes.Buffer
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&fingerprint, "%s:%d:%d\n", path, info.Size(), info.ModTime().UnixNano())
+	}
+	return fingerprint.String(), nil
+}
+
+// read parses all files, key can be used only once across all files
+func (f *ExpectationFiles) read(paths []string) (map[string]Expectation, error) {
+	exps := map[string]Expectation{}
+	sources := map[string]string{}
+	for _, path := range paths {
+		body, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.TrimSpace(body)
+		if len(body) > 0 && body[0] == '{' {
+			body = append(append([]byte("["), body...), ']')
+		}
+		fileExps, err := expectationsFromBytes(body)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err.Error())
+		}
+		for _, exp := range fileExps {
+			if source, ok := sources[exp.Key]; ok {
+				return nil, fmt.Errorf("%s: key %s is already used in %s", path, exp.Key, source)
+			}
+			sources[exp.Key] = path
+			exps[exp.Key] = exp
+		}
+	}
+	return exps, nil
+}
+
+// Reload reads files if they are changed and applies difference to controller: new expectations are added,
+// changed are updated, expectations removed from files are removed. If any file is invalid, nothing is changed.
+// Returns true if expectations were reloaded
+func (f *ExpectationFiles) Reload() (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	paths, err := f.paths()
+	if err != nil {
+		return false, err
+	}
+	fingerprint, err := f.stat(paths)
+	if err != nil {
+		return false, err
+	}
+	if fingerprint == f.fingerprint {
+		return false, nil
+	}
+	exps, err := f.read(paths)
+	if err != nil {
+		return false, err
+	}
+
+	changed := []Expectation{}
+	for key, exp := range exps {
+		if loaded, ok := f.loaded[key]; !ok || !reflect.DeepEqual(loaded, exp) {
+			changed = append(changed, exp)
+		}
+	}
+	removed := []string{}
+	for key := range f.loaded {
+		if _, ok := exps[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(removed)
+	if _, err = ControllerChangeExpectations(changed, removed, f.storeInjection); err != nil {
+		return false, err
+	}
+
+	f.fingerprint = fingerprint
+	f.loaded = exps
+	return true, nil
+}
+
+// Watch polls files with interval and reloads them on change until stop is closed. Errors are logged,
+// previously loaded expectations are kept until files are fixed
+func (f *ExpectationFiles) Watch(interval time.Duration, stop <-chan struct{}) {
+	fLog := log.With().Str("function", "ExpectationFiles.Watch").Logger()
+	if interval <= 0 {
+		interval = expectationFilesDefaultInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			reloaded, err := f.Reload()
+			if err != nil {
+				fLog.Error().Err(err).Msg("can't reload expectations from files")
+			} else if reloaded {
+				fLog.Info().Int("expectations", len(f.Loaded())).Msg("expectations are reloaded from files")
+			}
+		}
+	}
+}
+
+// Loaded returns sorted keys of expectations loaded from files
+func (f *ExpectationFiles) Loaded() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := make([]string, 0, len(f.loaded))
+	for key := range f.loaded {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeExpectationFile(t *testing.T, path string, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// modification time resolution of some file systems is one second
+	modTime := time.Now().Add(time.Duration(len(content)) * time.Second)
+	os.Chtimes(path, modTime, modTime)
+}
+
+func TestExpectationFiles_Reload_AddUpdateRemove(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	s := NewMemoryStore()
+	ControllerAddExpectation("api", Expectation{Key: "api"}, s)
+
+	writeExpectationFile(t, filepath.Join(dir, "a.json"), `[{"key":"a1","response":{"httpcode":200}},{"key":"a2","response":{"httpcode":200}}]`)
+	writeExpectationFile(t, filepath.Join(dir, "b.json"), `{"key":"b","response":{"httpcode":201}}`)
+	writeExpectationFile(t, filepath.Join(dir, "readme.txt"), `not expectations`)
+
+	files := ExpectationFilesOpen(nil, []string{dir}, s)
+	reloaded, err := files.Reload()
+	assert.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, []string{"a1", "a2", "b"}, files.Loaded())
+	assert.Len(t, s.List(), 4)
+
+	reloaded, err = files.Reload()
+	assert.NoError(t, err)
+	assert.False(t, reloaded)
+
+	writeExpectationFile(t, filepath.Join(dir, "a.json"), `[{"key":"a1","response":{"httpcode":404}}]`)
+	os.Remove(filepath.Join(dir, "b.json"))
+	writeExpectationFile(t, filepath.Join(dir, "c.json"), `{"key":"c","response":{"httpcode":200}}`)
+	reloaded, err = files.Reload()
+	assert.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, []string{"a1", "c"}, files.Loaded())
+	assert.Len(t, s.List(), 3)
+	assert.Equal(t, 404, s.List()["a1"].Response.HTTPCode)
+	assert.Contains(t, s.List(), "api")
+}
+
+func TestExpectationFiles_Reload_KeyOfAPIExpectation_Replaced(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	s := newTestStore(Expectation{Key: "shared", Response: &ExpectationResponse{HTTPCode: 500}})
+	path := filepath.Join(dir, "a.json")
+
+	writeExpectationFile(t, path, `[{"key":"shared","response":{"httpcode":200}}]`)
+	files := ExpectationFilesOpen([]string{path}, nil, s)
+	_, err := files.Reload()
+	assert.NoError(t, err)
+	assert.Equal(t, 200, s.List()["shared"].Response.HTTPCode)
+
+	writeExpectationFile(t, path, `[]`)
+	_, err = files.Reload()
+	assert.NoError(t, err)
+	assert.NotContains(t, s.List(), "shared")
+}
+
+func TestExpectationFiles_Reload_InvalidFileKeepsExpectations(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	s := NewMemoryStore()
+	path := filepath.Join(dir, "a.json")
+
+	writeExpectationFile(t, path, `[{"key":"a","response":{"httpcode":200}}]`)
+	files := ExpectationFilesOpen([]string{path}, nil, s)
+	_, err := files.Reload()
+	assert.NoError(t, err)
+
+	writeExpectationFile(t, path, `[{"key":"a","response":{"httpcode":999}}]`)
+	reloaded, err := files.Reload()
+	assert.Error(t, err)
+	assert.False(t, reloaded)
+	assert.Equal(t, 200, s.List()["a"].Response.HTTPCode)
+}
+
+func TestExpectationFiles_Reload_DuplicateKeysInFiles(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+
+	writeExpectationFile(t, filepath.Join(dir, "a.json"), `{"key":"same","response":{"httpcode":200}}`)
+	writeExpectationFile(t, filepath.Join(dir, "b.json"), `{"key":"same","response":{"httpcode":200}}`)
+	_, err := ExpectationFilesOpen(nil, []string{dir}, NewMemoryStore()).Reload()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "same")
+}
+
+func TestExpectationFiles_Reload_YAMLIsNotSupported(t *testing.T) {
+	_, err := ExpectationFilesOpen([]string{"exps.yaml"}, nil, NewMemoryStore()).Reload()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "YAML")
+}
+
+func TestExpectationFiles_Watch_ReloadsChangedFile(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	s := NewMemoryStore()
+	path := filepath.Join(dir, "a.json")
+	writeExpectationFile(t, path, `[]`)
+
+	files := ExpectationFilesOpen([]string{path}, nil, s)
+	stop := make(chan struct{})
+	defer close(stop)
+	go files.Watch(10*time.Millisecond, stop)
+
+	writeExpectationFile(t, path, `[{"key":"watched","response":{"httpcode":200}}]`)
+	for i := 0; i < 100 && len(files.Loaded()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, []string{"watched"}, files.Loaded())
+}
+
+func TestSplitFlagList(t *testing.T) {
+	assert.Equal(t, []string{"a", "b"}, splitFlagList(" a,,b "))
+	assert.Equal(t, []string{}, splitFlagList(""))
+}
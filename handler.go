@@ -1,34 +1,57 @@
 package main
 
 import (
+	"bytes"
+	"compress/flate"
 	"compress/gzip"
+	"compress/zlib"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
+const (
+	expectationsPath         = "/gozzmock/expectations"
+	expectationsDefaultLimit = 100
+	namespacesPath           = "/gozzmock/namespaces"
+)
+
 // HandlerAddExpectation handler parses request and adds expectation to global expectations list
 func HandlerAddExpectation(w http.ResponseWriter, r *http.Request) {
 	fLog := log.With().Str("function", "HandlerAddExpectation").Logger()
 
-	if r.Method != "POST" {
-		fLog.Panic().Msgf("Wrong method %s", r.Method)
+	if !apiCheckMethod(w, r, "POST") {
+		return
+	}
+	_, nsStore, ok := requestNamespace(w, r)
+	if !ok {
 		return
 	}
 
-	exp := ExpectationFromReadCloser(r.Body)
+	exp, err := ExpectationFromReadCloser(r.Body)
+	if err != nil {
+		fLog.Error().Err(err).Msg("Can't add expectation")
+		apiWriteError(w, err)
+		return
+	}
 
-	var exps = ControllerAddExpectation(exp.Key, exp, nil)
+	exps, err := ControllerAddExpectation(exp.Key, exp, nsStore)
+	if err != nil {
+		apiWriteError(w, err)
+		return
+	}
 
 	expsjson, err := json.Marshal(exps)
 	if err != nil {
-		fLog.Panic().Err(err)
+		apiWriteError(w, APIInternal("can't encode response: "+err.Error()))
 		return
 	}
 	w.Write(expsjson)
@@ -36,49 +59,825 @@ func HandlerAddExpectation(w http.ResponseWriter, r *http.Request) {
 
 // HandlerRemoveExpectation handler parses request and deletes expectation from global expectations list
 func HandlerRemoveExpectation(w http.ResponseWriter, r *http.Request) {
-	fLog := log.With().Str("function", "HandlerRemoveExpectation").Logger()
-
-	if r.Method != "POST" {
-		fLog.Panic().Msgf("Wrong method %s", r.Method)
+	if !apiCheckMethod(w, r, "POST") {
 		return
 	}
 	defer r.Body.Close()
+	_, nsStore, ok := requestNamespace(w, r)
+	if !ok {
+		return
+	}
 
 	requestBody := ExpectationRemove{}
-	bodyDecoder := json.NewDecoder(r.Body)
-	err := bodyDecoder.Decode(&requestBody)
+	if apiErr := APIDecodeJSON(r.Body, &requestBody); apiErr != nil {
+		apiWriteError(w, apiErr)
+		return
+	}
+
+	if requestBody.Key == "" {
+		apiWriteError(w, APIUnprocessable("expectation key is invalid", APIFieldError{Field: "key", Message: "key is required"}))
+		return
+	}
+
+	exps, err := ControllerRemoveExpectation(requestBody.Key, nsStore)
+	if err != nil {
+		apiWriteError(w, err)
+		return
+	}
+	expsjson, err := json.Marshal(exps)
+	if err != nil {
+		apiWriteError(w, APIInternal("can't encode response: "+err.Error()))
+		return
+	}
+	w.Write(expsjson)
+}
+
+// HandlerAddExpectations handler adds array of expectations at once. If any expectation is invalid, none is added.
+// Query parameter reset=true removes all other expectations
+func HandlerAddExpectations(w http.ResponseWriter, r *http.Request) {
+	fLog := log.With().Str("function", "HandlerAddExpectations").Logger()
+
+	if !apiCheckMethod(w, r, "POST") {
+		return
+	}
+
+	_, nsStore, ok := requestNamespace(w, r)
+	if !ok {
+		return
+	}
+
+	newExps, err := ExpectationsFromReadCloser(r.Body)
 	if err != nil {
-		fLog.Panic().Err(err)
+		fLog.Error().Err(err).Msg("Can't add expectations")
+		apiWriteError(w, err)
+		return
+	}
+
+	exps, err := ControllerAddExpectations(newExps, r.URL.Query().Get("reset") == "true", nsStore)
+	if err != nil {
+		apiWriteError(w, err)
 		return
 	}
 
-	var exps = ControllerRemoveExpectation(requestBody.Key, nil)
 	expsjson, err := json.Marshal(exps)
 	if err != nil {
-		fLog.Panic().Err(err)
+		apiWriteError(w, APIInternal("can't encode response: "+err.Error()))
 		return
 	}
 	w.Write(expsjson)
 }
 
-// HandlerGetExpectations handler parses request and returns global expectations list
+// HandlerResetExpectations handler removes all expectations
+func HandlerResetExpectations(w http.ResponseWriter, r *http.Request) {
+	if !apiCheckMethod(w, r, "POST") {
+		return
+	}
+
+	_, nsStore, ok := requestNamespace(w, r)
+	if !ok {
+		return
+	}
+
+	exps, err := ControllerResetExpectations(nsStore)
+	if err != nil {
+		apiWriteError(w, err)
+		return
+	}
+	expsjson, err := json.Marshal(exps)
+	if err != nil {
+		apiWriteError(w, APIInternal("can't encode response: "+err.Error()))
+		return
+	}
+	w.Write(expsjson)
+}
+
+// HandlerRemoveExpectations handler removes expectations which keys pass filter and labels match selector.
+// Key in body is a regex or substring, labels is a label selector. Returns removed keys
+func HandlerRemoveExpectations(w http.ResponseWriter, r *http.Request) {
+	if !apiCheckMethod(w, r, "POST") {
+		return
+	}
+	defer r.Body.Close()
+
+	_, nsStore, ok := requestNamespace(w, r)
+	if !ok {
+		return
+	}
+
+	requestBody := ExpectationRemoveFilter{}
+	if apiErr := APIDecodeJSON(r.Body, &requestBody); apiErr != nil {
+		apiWriteError(w, apiErr)
+		return
+	}
+
+	fields := []APIFieldError{}
+	if requestBody.Key == "" && requestBody.Labels == "" {
+		fields = append(fields, APIFieldError{Field: "key", Message: "key filter or labels selector is required, use reset_expectations to remove all expectations"})
+	}
+	validateRegex(&fields, "key", requestBody.Key)
+	selector, err := ParseLabelSelector(requestBody.Labels)
+	if err != nil {
+		fields = append(fields, APIFieldError{Field: "labels", Message: err.Error()})
+	}
+	if len(fields) > 0 {
+		apiWriteError(w, APIUnprocessable("filter is invalid", fields...))
+		return
+	}
+
+	removed, err := ControllerRemoveExpectations(requestBody.Key, selector, nsStore)
+	if err != nil {
+		apiWriteError(w, err)
+		return
+	}
+	removedjson, err := json.Marshal(removed)
+	if err != nil {
+		apiWriteError(w, APIInternal("can't encode response: "+err.Error()))
+		return
+	}
+	w.Write(removedjson)
+}
+
+// HandlerExpectations handler is resource-style API for expectations:
+// GET /gozzmock/expectations returns page of expectations, GET, PUT, PATCH and DELETE /gozzmock/expectations/{key}
+// read and change single expectation. Changes are checked against If-Match and If-None-Match headers
+func HandlerExpectations(w http.ResponseWriter, r *http.Request) {
+	_, nsStore, ok := requestNamespace(w, r)
+	if !ok {
+		return
+	}
+
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, expectationsPath), "/")
+	if key == "" {
+		if apiCheckMethod(w, r, "GET") {
+			listExpectations(w, r, nsStore)
+		}
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		getExpectation(w, r, key, nsStore)
+	case "PUT", "PATCH", "DELETE":
+		updateExpectation(w, r, key, nsStore)
+	default:
+		apiCheckMethod(w, r, "GET", "PUT", "PATCH", "DELETE")
+	}
+}
+
+func listExpectations(w http.ResponseWriter, r *http.Request, nsStore Store) {
+	query := r.URL.Query()
+	page := ExpectationsPage{Limit: expectationsDefaultLimit}
+	fields := []APIFieldError{}
+	for _, param := range []struct {
+		name  string
+		value *int
+	}{{"offset", &page.Offset}, {"limit", &page.Limit}} {
+		if value := query.Get(param.name); value != "" {
+			number, err := strconv.Atoi(value)
+			if err != nil || number < 0 {
+				fields = append(fields, APIFieldError{Field: param.name, Message: param.name + " should be a non-negative number"})
+				continue
+			}
+			*param.value = number
+		}
+	}
+	validateRegex(&fields, "key", query.Get("key"))
+	selector, err := ParseLabelSelector(query.Get("labels"))
+	if err != nil {
+		fields = append(fields, APIFieldError{Field: "labels", Message: err.Error()})
+	}
+	if len(fields) > 0 {
+		apiWriteError(w, APIBadRequest("invalid query", fields...))
+		return
+	}
+
+	page.Expectations, page.Total = ControllerListExpectations(query.Get("key"), selector, page.Offset, page.Limit, nsStore)
+	pagejson, err := json.Marshal(page)
+	if err != nil {
+		apiWriteError(w, APIInternal("can't encode response: "+err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(pagejson)
+}
+
+func getExpectation(w http.ResponseWriter, r *http.Request, key string, nsStore Store) {
+	exp, ok := ControllerGetExpectation(key, nsStore)
+	if !ok {
+		apiWriteError(w, &APIError{Status: http.StatusNotFound, Message: fmt.Sprintf("expectation %s doesn't exist", key)})
+		return
+	}
+
+	etag := ExpectationETag(exp)
+	w.Header().Set("ETag", etag)
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeExpectation(w, http.StatusOK, exp)
+}
+
+func updateExpectation(w http.ResponseWriter, r *http.Request, key string, nsStore Store) {
+	fLog := log.With().Str("function", "updateExpectation").Str("key", key).Logger()
+
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		apiWriteError(w, APIBadRequest("can't read body: "+err.Error()))
+		return
+	}
+
+	created := false
+	exp, err := ControllerUpdateExpectation(key, func(current *Expectation) (*Expectation, error) {
+		if apiErr := checkExpectationPreconditions(r, current); apiErr != nil {
+			return nil, apiErr
+		}
+		if current == nil && r.Method != "PUT" {
+			return nil, &APIError{Status: http.StatusNotFound, Message: fmt.Sprintf("expectation %s doesn't exist", key)}
+		}
+		switch r.Method {
+		case "PUT":
+			created = current == nil
+		case "PATCH":
+			currentjson, err := json.Marshal(*current)
+			if err != nil {
+				return nil, err
+			}
+			body, err = TransformJSONMergePatch(currentjson, body)
+			if err != nil {
+				return nil, APIBadRequest("invalid JSON merge patch: " + err.Error())
+			}
+		case "DELETE":
+			return nil, nil
+		}
+		exp, err := ExpectationFromBytes(body, key)
+		if err != nil {
+			return nil, err
+		}
+		return &exp, nil
+	}, nsStore)
+	if err != nil {
+		fLog.Error().Err(err).Msgf("Can't %s expectation", r.Method)
+		apiWriteError(w, err)
+		return
+	}
+
+	if exp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("ETag", ExpectationETag(*exp))
+	if created {
+		writeExpectation(w, http.StatusCreated, *exp)
+		return
+	}
+	writeExpectation(w, http.StatusOK, *exp)
+}
+
+// checkExpectationPreconditions checks If-Match and If-None-Match headers against current expectation
+func checkExpectationPreconditions(r *http.Request, current *Expectation) *APIError {
+	etag := ""
+	if current != nil {
+		etag = ExpectationETag(*current)
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && (current == nil || !etagMatches(ifMatch, etag)) {
+		return &APIError{Status: http.StatusPreconditionFailed, Message: "expectation was changed, ETag doesn't match If-Match"}
+	}
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && current != nil && etagMatches(ifNoneMatch, etag) {
+		return &APIError{Status: http.StatusPreconditionFailed, Message: "expectation already exists"}
+	}
+	return nil
+}
+
+// etagMatches checks whether header with list of entity tags or "*" matches etag
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func writeExpectation(w http.ResponseWriter, statusCode int, exp Expectation) {
+	expjson, err := json.Marshal(exp)
+	if err != nil {
+		apiWriteError(w, APIInternal("can't encode response: "+err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(expjson)
+}
+
+// HandlerGetExpectations handler parses request and returns global expectations list.
+// Query parameter "labels" is a label selector
 func HandlerGetExpectations(w http.ResponseWriter, r *http.Request) {
-	fLog := log.With().Str("function", "HandlerGetExpectations").Logger()
+	if !apiCheckMethod(w, r, "GET") {
+		return
+	}
 
-	if r.Method != "GET" {
-		fLog.Panic().Msgf("Wrong method %s", r.Method)
+	_, nsStore, ok := requestNamespace(w, r)
+	if !ok {
 		return
 	}
 
-	var exps = ControllerGetExpectations(nil)
+	var exps = ControllerGetSnapshot(nsStore)
+	if labels := r.URL.Query().Get("labels"); labels != "" {
+		selector, err := ParseLabelSelector(labels)
+		if err != nil {
+			apiWriteError(w, APIBadRequest("invalid query", APIFieldError{Field: "labels", Message: err.Error()}))
+			return
+		}
+		page, _ := ControllerListExpectations("", selector, 0, 0, nsStore)
+		exps = Expectations{}
+		for _, exp := range page {
+			exps[exp.Key] = exp
+		}
+	}
 	expsjson, err := json.Marshal(exps)
 	if err != nil {
-		fLog.Panic().Err(err)
+		apiWriteError(w, APIInternal("can't encode response: "+err.Error()))
 		return
 	}
 	fmt.Fprint(w, string(expsjson))
 }
 
+// HandlerGetMirrorDiffs handler returns differences between primary and mirror responses recorded in namespace
+func HandlerGetMirrorDiffs(w http.ResponseWriter, r *http.Request) {
+	if !apiCheckMethod(w, r, "GET") {
+		return
+	}
+
+	namespace, _, ok := requestNamespace(w, r)
+	if !ok {
+		return
+	}
+
+	diffsjson, err := json.Marshal(MirrorGetDiffs(namespace))
+	if err != nil {
+		apiWriteError(w, APIInternal("can't encode response: "+err.Error()))
+		return
+	}
+	w.Write(diffsjson)
+}
+
+// HandlerResetMirrorDiffs handler removes mirror diffs recorded in namespace
+func HandlerResetMirrorDiffs(w http.ResponseWriter, r *http.Request) {
+	if !apiCheckMethod(w, r, "POST") {
+		return
+	}
+
+	namespace, _, ok := requestNamespace(w, r)
+	if !ok {
+		return
+	}
+
+	MirrorResetDiffs(namespace)
+	w.Write([]byte("[]"))
+}
+
+// HandlerUnmatched handler returns (GET) or sets (POST) behaviour for requests which don't pass any expectation filter
+func HandlerUnmatched(w http.ResponseWriter, r *http.Request) {
+	fLog := log.With().Str("function", "HandlerUnmatched").Logger()
+
+	switch r.Method {
+	case "GET":
+	case "POST":
+		defer r.Body.Close()
+		u := Unmatched{}
+		if apiErr := APIDecodeJSON(r.Body, &u); apiErr != nil {
+			apiWriteError(w, apiErr)
+			return
+		}
+		err := UnmatchedSet(u)
+		if err != nil {
+			fLog.Error().Err(err).Msg("Can't set behaviour for unmatched requests")
+			apiWriteError(w, APIUnprocessable(err.Error()))
+			return
+		}
+	default:
+		apiCheckMethod(w, r, "GET", "POST")
+		return
+	}
+
+	unmatchedjson, err := json.Marshal(UnmatchedGet())
+	if err != nil {
+		apiWriteError(w, APIInternal("can't encode response: "+err.Error()))
+		return
+	}
+	w.Write(unmatchedjson)
+}
+
+// HandlerCACertificate handler returns certificate of authority used for HTTPS interception
+func HandlerCACertificate(w http.ResponseWriter, r *http.Request) {
+	m := MITMGet()
+	if m == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("HTTPS interception is disabled"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Write(m.CACertificatePEM())
+}
+
+// HandlerGetCache handler returns cached responses of forward targets in namespace. Query parameter "key" filters by expectation key
+func HandlerGetCache(w http.ResponseWriter, r *http.Request) {
+	if !apiCheckMethod(w, r, "GET") {
+		return
+	}
+	namespace, _, ok := requestNamespace(w, r)
+	if !ok {
+		return
+	}
+
+	entriesjson, err := json.Marshal(CacheGetEntries(namespace, r.URL.Query().Get("key")))
+	if err != nil {
+		apiWriteError(w, APIInternal("can't encode response: "+err.Error()))
+		return
+	}
+	w.Write(entriesjson)
+}
+
+// HandlerPurgeCache handler removes cached responses of expectation with particular key or all cached responses in namespace
+func HandlerPurgeCache(w http.ResponseWriter, r *http.Request) {
+	if !apiCheckMethod(w, r, "POST") {
+		return
+	}
+	defer r.Body.Close()
+	namespace, _, ok := requestNamespace(w, r)
+	if !ok {
+		return
+	}
+
+	requestBody := ExpectationRemove{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		apiWriteError(w, APIInternal("can't read request body: "+err.Error()))
+		return
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if apiErr := APIDecodeJSON(bytes.NewReader(body), &requestBody); apiErr != nil {
+			apiWriteError(w, apiErr)
+			return
+		}
+	}
+
+	CachePurgeNamespace(namespace, requestBody.Key)
+	entriesjson, err := json.Marshal(CacheGetEntries(namespace, ""))
+	if err != nil {
+		apiWriteError(w, APIInternal("can't encode response: "+err.Error()))
+		return
+	}
+	w.Write(entriesjson)
+}
+
+// HandlerGetRequests handler returns journal of received requests.
+// Query parameters filter requests: method, host, path, body, key (of applied expectation), unmatched=true, limit
+func HandlerGetRequests(w http.ResponseWriter, r *http.Request) {
+	if !apiCheckMethod(w, r, "GET") {
+		return
+	}
+
+	namespace, _, ok := requestNamespace(w, r)
+	if !ok {
+		return
+	}
+
+	filter, err := JournalFilterFromQuery(r.URL.Query())
+	if err != nil {
+		apiWriteError(w, err)
+		return
+	}
+	filter.Namespace = namespace
+
+	entriesjson, err := json.Marshal(JournalGet(filter))
+	if err != nil {
+		apiWriteError(w, APIInternal("can't encode response: "+err.Error()))
+		return
+	}
+	w.Write(entriesjson)
+}
+
+// HandlerGetHAR handler returns journal of received requests as HTTP Archive. Query parameters are the same as for requests journal
+func HandlerGetHAR(w http.ResponseWriter, r *http.Request) {
+	if !apiCheckMethod(w, r, "GET") {
+		return
+	}
+
+	namespace, _, ok := requestNamespace(w, r)
+	if !ok {
+		return
+	}
+
+	filter, err := JournalFilterFromQuery(r.URL.Query())
+	if err != nil {
+		apiWriteError(w, err)
+		return
+	}
+	filter.Namespace = namespace
+
+	harjson, err := json.Marshal(HARFromJournal(JournalGet(filter)))
+	if err != nil {
+		apiWriteError(w, APIInternal("can't encode response: "+err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename=gozzmock.har")
+	w.Write(harjson)
+}
+
+// HandlerImportHAR handler converts HTTP Archive to response expectations and adds them to global expectations list.
+// Query parameters: prefix - prefix of expectation keys, priority - priority of expectations, matchurl=true - filter by full URL
+func HandlerImportHAR(w http.ResponseWriter, r *http.Request) {
+	fLog := log.With().Str("function", "HandlerImportHAR").Logger()
+
+	if !apiCheckMethod(w, r, "POST") {
+		return
+	}
+	defer r.Body.Close()
+	_, nsStore, ok := requestNamespace(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	options := HARImportOptions{KeyPrefix: query.Get("prefix"), MatchURL: query.Get("matchurl") == "true"}
+	if priority := query.Get("priority"); priority != "" {
+		var err error
+		options.Priority, err = strconv.Atoi(priority)
+		if err != nil {
+			apiWriteError(w, APIBadRequest("invalid query", APIFieldError{Field: "priority", Message: "priority should be a number"}))
+			return
+		}
+	}
+
+	har := HAR{}
+	if apiErr := APIDecodeJSON(r.Body, &har); apiErr != nil {
+		apiWriteError(w, apiErr)
+		return
+	}
+
+	exps, err := HARToExpectations(har, options)
+	if err != nil {
+		fLog.Error().Err(err).Msg("Can't convert HAR to expectations")
+		apiWriteError(w, err)
+		return
+	}
+	if _, err = ControllerAddExpectations(exps, false, nsStore); err != nil {
+		apiWriteError(w, err)
+		return
+	}
+
+	expsjson, err := json.Marshal(exps)
+	if err != nil {
+		apiWriteError(w, APIInternal("can't encode response: "+err.Error()))
+		return
+	}
+	w.Write(expsjson)
+}
+
+// HandlerResetRequests handler removes all requests from journal
+func HandlerResetRequests(w http.ResponseWriter, r *http.Request) {
+	if !apiCheckMethod(w, r, "POST") {
+		return
+	}
+
+	namespace, _, ok := requestNamespace(w, r)
+	if !ok {
+		return
+	}
+
+	JournalResetNamespace(namespace)
+	w.Write([]byte("[]"))
+}
+
+// HandlerVerify handler checks number of received requests which pass filter.
+// Returns 200 if verification passed, otherwise 406
+func HandlerVerify(w http.ResponseWriter, r *http.Request) {
+	if !apiCheckMethod(w, r, "POST") {
+		return
+	}
+	defer r.Body.Close()
+	namespace, _, ok := requestNamespace(w, r)
+	if !ok {
+		return
+	}
+
+	v := Verification{}
+	if apiErr := APIDecodeJSON(r.Body, &v); apiErr != nil {
+		apiWriteError(w, apiErr)
+		return
+	}
+	if apiErr := validateLabelSelector(v.Labels); apiErr != nil {
+		apiWriteError(w, apiErr)
+		return
+	}
+
+	writeVerificationResult(w, Verify(namespace, v))
+}
+
+// HandlerVerifySequence handler checks that requests were received in order.
+// Returns 200 if verification passed, otherwise 406
+func HandlerVerifySequence(w http.ResponseWriter, r *http.Request) {
+	if !apiCheckMethod(w, r, "POST") {
+		return
+	}
+	defer r.Body.Close()
+	namespace, _, ok := requestNamespace(w, r)
+	if !ok {
+		return
+	}
+
+	v := VerificationSequence{}
+	if apiErr := APIDecodeJSON(r.Body, &v); apiErr != nil {
+		apiWriteError(w, apiErr)
+		return
+	}
+	if apiErr := validateLabelSelector(v.Labels); apiErr != nil {
+		apiWriteError(w, apiErr)
+		return
+	}
+
+	writeVerificationResult(w, VerifySequence(namespace, v))
+}
+
+func validateLabelSelector(labels string) *APIError {
+	if _, err := ParseLabelSelector(labels); err != nil {
+		return APIUnprocessable("verification is invalid", APIFieldError{Field: "labels", Message: err.Error()})
+	}
+	return nil
+}
+
+func writeVerificationResult(w http.ResponseWriter, result VerificationResult) {
+	resultjson, err := json.Marshal(result)
+	if err != nil {
+		apiWriteError(w, APIInternal("can't encode response: "+err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !result.Passed {
+		w.WriteHeader(http.StatusNotAcceptable)
+	}
+	w.Write(resultjson)
+}
+
+// HandlerExplain handler returns the closest expectations for request. Request is taken from journal by query parameter "id",
+// from POST body, or it is the latest unmatched request in journal
+func HandlerExplain(w http.ResponseWriter, r *http.Request) {
+	namespace, _, ok := requestNamespace(w, r)
+	if !ok {
+		return
+	}
+
+	var req *ExpectationRequest
+	switch r.Method {
+	case "GET":
+		filter := JournalFilter{Namespace: namespace, Unmatched: true, Limit: 1}
+		if id := r.URL.Query().Get("id"); id != "" {
+			var err error
+			filter = JournalFilter{Namespace: namespace, Limit: 1}
+			filter.ID, err = strconv.ParseInt(id, 10, 64)
+			if err != nil {
+				apiWriteError(w, APIBadRequest("invalid query", APIFieldError{Field: "id", Message: "id should be a number"}))
+				return
+			}
+		}
+		entries := JournalGet(filter)
+		if len(entries) == 0 {
+			apiWriteError(w, &APIError{Status: http.StatusNotFound, Message: "no request in journal"})
+			return
+		}
+		req = &entries[0].Request
+	case "POST":
+		defer r.Body.Close()
+		req = &ExpectationRequest{}
+		if apiErr := APIDecodeJSON(r.Body, req); apiErr != nil {
+			apiWriteError(w, apiErr)
+			return
+		}
+		req.namespace = namespace
+	default:
+		apiCheckMethod(w, r, "GET", "POST")
+		return
+	}
+
+	explanationjson, err := json.Marshal(Explain(req))
+	if err != nil {
+		apiWriteError(w, APIInternal("can't encode response: "+err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(explanationjson)
+}
+
+// requestNamespace returns namespace selected by request header and its store for controller.
+// Writes 404 error if namespace doesn't exist
+func requestNamespace(w http.ResponseWriter, r *http.Request) (string, Store, bool) {
+	namespace := r.Header.Get(namespaceHeader)
+	s, ok := NamespaceStore(namespace)
+	if !ok {
+		apiWriteError(w, &APIError{Status: http.StatusNotFound, Message: fmt.Sprintf("namespace %s doesn't exist", namespace)})
+		return namespace, nil, false
+	}
+	return namespace, s, true
+}
+
+// HandlerNamespaces handler lists (GET) and creates (POST with {"name": "..."}) namespaces,
+// DELETE /gozzmock/namespaces/{name} removes namespace with its expectations and journal
+func HandlerNamespaces(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, namespacesPath), "/")
+	if name != "" {
+		if !apiCheckMethod(w, r, "DELETE") {
+			return
+		}
+		if !NamespaceDelete(name) {
+			apiWriteError(w, &APIError{Status: http.StatusNotFound, Message: fmt.Sprintf("namespace %s doesn't exist", name)})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+	case "POST":
+		defer r.Body.Close()
+		requestBody := struct {
+			Name string `json:"name"`
+		}{}
+		if apiErr := APIDecodeJSON(r.Body, &requestBody); apiErr != nil {
+			apiWriteError(w, apiErr)
+			return
+		}
+		if err := NamespaceCreate(requestBody.Name); err != nil {
+			status := http.StatusUnprocessableEntity
+			if _, exists := NamespaceStore(requestBody.Name); exists {
+				status = http.StatusConflict
+			}
+			apiWriteError(w, &APIError{Status: status, Message: err.Error()})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(requestBody)
+		return
+	default:
+		apiCheckMethod(w, r, "GET", "POST")
+		return
+	}
+
+	namesjson, err := json.Marshal(NamespaceList())
+	if err != nil {
+		apiWriteError(w, APIInternal("can't encode response: "+err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(namesjson)
+}
+
+// HandlerSnapshot handler exports (GET) and imports (POST) full server state: expectations of all namespaces,
+// behaviour for unmatched requests and request journal
+func HandlerSnapshot(w http.ResponseWriter, r *http.Request) {
+	fLog := log.With().Str("function", "HandlerSnapshot").Logger()
+
+	switch r.Method {
+	case "GET":
+	case "POST":
+		defer r.Body.Close()
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			apiWriteError(w, APIBadRequest("can't read body: "+err.Error()))
+			return
+		}
+		snapshot, err := SnapshotFromBytes(body)
+		if err != nil {
+			apiWriteError(w, err)
+			return
+		}
+		if err = SnapshotImport(snapshot); err != nil {
+			fLog.Error().Err(err).Msg("Can't import snapshot")
+			apiWriteError(w, APIUnprocessable(err.Error()))
+			return
+		}
+	default:
+		apiCheckMethod(w, r, "GET", "POST")
+		return
+	}
+
+	snapshotjson, err := json.Marshal(SnapshotExport())
+	if err != nil {
+		apiWriteError(w, APIInternal("can't encode response: "+err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == "GET" {
+		w.Header().Set("Content-Disposition", "attachment; filename=gozzmock.snapshot.json")
+	}
+	w.Write(snapshotjson)
+}
+
 // HandlerStatus handler returns applications status
 func HandlerStatus(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, "gozzmock status is OK")
@@ -86,70 +885,191 @@ func HandlerStatus(w http.ResponseWriter, r *http.Request) {
 
 // HandlerDefault handler is an entry point for all incoming requests
 func HandlerDefault(w http.ResponseWriter, r *http.Request) {
-	generateResponseToResponseWriter(w, ControllerTranslateRequestToExpectation(r))
+	start := time.Now()
+	req := ControllerTranslateRequestToExpectation(r)
+	recorder := &journalResponseWriter{ResponseWriter: w}
+
+	exp := Expectation{}
+	if r.Method == http.MethodConnect {
+		ProxyConnect(recorder, r)
+	} else {
+		exp = generateResponseToResponseWriter(recorder, req)
+	}
+
+	JournalAdd(start, req, exp.Key, exp.Labels, recorder.response())
 }
 
 func uploadResponseToResponseWriter(w http.ResponseWriter, resp *ExpectationResponse) {
-	w.WriteHeader(resp.HTTPCode)
-	w.Write([]byte(resp.Body))
 	if resp.Headers != nil {
 		for name, value := range *resp.Headers {
 			w.Header().Set(name, value)
 		}
 	}
+	w.WriteHeader(resp.HTTPCode)
+	w.Write([]byte(resp.Body))
 }
 
-func generateResponseToResponseWriter(w http.ResponseWriter, req *ExpectationRequest) {
+// generateResponseToResponseWriter applies the first expectation which request passes. Returns applied expectation or empty expectation
+func generateResponseToResponseWriter(w http.ResponseWriter, req *ExpectationRequest) Expectation {
 	fLog := log.With().Str("function", "generateResponseToResponseWriter").Logger()
 
-	storedExpectations := ControllerGetExpectations(nil)
-	orderedStoredExpectations := ControllerSortExpectationsByPriority(storedExpectations)
-	for i := 0; i < len(orderedStoredExpectations); i++ {
-		exp := orderedStoredExpectations[i]
-
-		if !ControllerRequestPassesFilter(req, exp.Request) {
-			continue
-		}
+	nsStore, ok := NamespaceStore(req.namespace)
+	if !ok {
+		apiWriteError(w, &APIError{Status: http.StatusNotFound, Message: fmt.Sprintf("namespace %s doesn't exist", req.namespace)})
+		return Expectation{}
+	}
 
+	if exp, ok := ControllerMatchExpectation(req, nsStore); ok {
 		time.Sleep(time.Second * exp.Delay)
 
 		if exp.Response != nil {
 			fLog.Info().Str("key", exp.Key).Msg("Apply response expectation")
 			uploadResponseToResponseWriter(w, exp.Response)
-			return
+			startMirror(exp, req, upstreamResponseFromExpectation(exp.Response))
+			return exp
 		}
 
 		if exp.Forward != nil {
 			fLog.Info().Str("key", exp.Key).Msg("Apply forward expectation")
-			httpReq := ControllerCreateHTTPRequest(req, exp.Forward)
-			doHTTPRequest(w, httpReq)
-			return
+			startMirror(exp, req, doHTTPRequest(w, NamespaceStateKey(req.namespace, exp.Key), exp.Key, req, exp.Forward))
+			return exp
 		}
 	}
-	fLog.Error().Msg("No expectations in gozzmock for request!")
+	uploadUnmatchedResponse(w, req)
+	return Expectation{}
+}
+
+// hopByHopHeaders are meaningful only for a single connection and must not be forwarded
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
 
-	w.WriteHeader(http.StatusNotImplemented)
-	w.Write([]byte("No expectations in gozzmock for request!"))
+// upstreamResponse is a buffered response received from forward target
+type upstreamResponse struct {
+	StatusCode int
+	Header     http.Header
+	Trailer    http.Header
+	Body       []byte
 }
 
-func readResponseBody(resp *http.Response) ([]byte, error) {
-	var reader io.ReadCloser
-	if resp.Header.Get("Content-Encoding") == "gzip" {
-		reader, err := gzip.NewReader(resp.Body)
-		defer reader.Close()
+// decodeContentEncoding returns reader which decodes body according to Content-Encoding.
+// Returns nil if encoding is not supported
+func decodeContentEncoding(encoding string, body []byte) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		// RFC 7230 defines deflate as zlib stream, but some servers send raw deflate data
+		reader, err := zlib.NewReader(bytes.NewReader(body))
 		if err != nil {
-			return nil, err
+			return flate.NewReader(bytes.NewReader(body)), nil
 		}
-	} else {
-		reader = resp.Body
+		return reader, nil
+	}
+	return nil, nil
+}
+
+func readResponseBody(resp *http.Response, decode bool) ([]byte, error) {
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
 	}
 
-	body, err := ioutil.ReadAll(reader)
+	encoding := resp.Header.Get("Content-Encoding")
+	if !decode || encoding == "" {
+		return body, nil
+	}
+
+	reader, err := decodeContentEncoding(encoding, body)
 	if err != nil {
 		return nil, err
 	}
+	if reader == nil {
+		return body, nil
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
 
-	return body, nil
+	decoded, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	resp.Header.Del("Content-Encoding")
+	return decoded, nil
+}
+
+// readUpstreamResponse reads whole response from forward target including trailers
+func readUpstreamResponse(resp *http.Response, decode bool) (*upstreamResponse, error) {
+	body, err := readResponseBody(resp, decode)
+	if err != nil {
+		return nil, err
+	}
+
+	header := cloneHeader(resp.Header)
+	for _, name := range hopByHopHeaders {
+		header.Del(name)
+	}
+	// body is buffered, length is calculated again when response is written
+	header.Del("Content-Length")
+
+	return &upstreamResponse{
+		StatusCode: resp.StatusCode,
+		Header:     header,
+		Trailer:    cloneHeader(resp.Trailer),
+		Body:       body}, nil
+}
+
+// writeUpstreamResponse writes headers, status code, body and trailers to response writer
+func writeUpstreamResponse(w http.ResponseWriter, resp *upstreamResponse) {
+	for name, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	for name := range resp.Trailer {
+		w.Header().Add("Trailer", name)
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	w.Write(resp.Body)
+
+	for name, values := range resp.Trailer {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+}
+
+// writeForwardError writes fallback or diagnostic response when forward target is unavailable
+func writeForwardError(w http.ResponseWriter, key string, fwd *ExpectationForward, err error) *upstreamResponse {
+	errorResp := forwardErrorResponse(key, fwd, err)
+	writeUpstreamResponse(w, errorResp)
+	return errorResp
+}
+
+func cloneUpstreamResponse(resp *upstreamResponse) *upstreamResponse {
+	return &upstreamResponse{
+		StatusCode: resp.StatusCode,
+		Header:     cloneHeader(resp.Header),
+		Trailer:    cloneHeader(resp.Trailer),
+		Body:       append([]byte(nil), resp.Body...)}
+}
+
+func cloneHeader(header http.Header) http.Header {
+	clone := make(http.Header, len(header))
+	for name, values := range header {
+		clone[name] = append([]string(nil), values...)
+	}
+	return clone
 }
 
 // LogRequest dumps http request and writes content to log
@@ -157,41 +1077,98 @@ func LogRequest(req *http.Request) {
 	fLog := log.With().Str("function", "LogRequest").Logger()
 	reqDumped, err := httputil.DumpRequest(req, true)
 	if err != nil {
-		fLog.Panic().Err(err)
+		fLog.Error().Err(err).Msg("Can't dump request")
 		return
 	}
 	fLog.Debug().Str("messagetype", "Request").Msg(string(reqDumped))
 }
 
-func doHTTPRequest(w http.ResponseWriter, httpReq *http.Request) {
-	fLog := log.With().Str("function", "doHTTPRequest").Logger()
+// forwardTransport is shared by forward and mirror requests, so keep-alive connections to targets are reused.
+// Body is decoded explicitly according to forward rules, transport shouldn't do it implicitly
+var forwardTransport = &http.Transport{
+	Proxy:               http.ProxyFromEnvironment,
+	MaxIdleConnsPerHost: 16,
+	IdleConnTimeout:     90 * time.Second,
+	DisableCompression:  true}
 
-	if httpReq == nil {
-		fLog.Panic().Msg("http.Request is nil")
-		return
-	}
+// forwardClient returns client of shared transport with timeout of request, zero timeout means no timeout
+func forwardClient(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: forwardTransport, Timeout: timeout}
+}
 
-	httpClient := &http.Client{}
+// sendToForwardTargets sends request to forward targets in order chosen by balancer until one of them responds
+func sendToForwardTargets(key string, req *ExpectationRequest, fwd *ExpectationForward) (*http.Response, error) {
+	fLog := log.With().Str("function", "sendToForwardTargets").Logger()
 
-	resp, err := httpClient.Do(httpReq)
-	if err != nil {
-		fLog.Panic().Err(err)
-		return
-	}
+	httpClient := forwardClient(time.Second * fwd.Timeout)
 
-	body, err := readResponseBody(resp)
-	if err != nil {
-		fLog.Panic().Err(err)
-		return
+	var lastErr error
+	for _, host := range BalancerOrderHosts(key, fwd) {
+		target := *fwd
+		target.Host = host
+		httpReq := ControllerCreateHTTPRequest(req, &target)
+		if httpReq == nil {
+			return nil, fmt.Errorf("can't create request to %s", host)
+		}
+
+		resp, err := httpClient.Do(httpReq)
+		if err != nil {
+			fLog.Error().Err(err).Str("host", host).Msg("Forward target is unavailable")
+			BalancerReportFailure(key, fwd, host)
+			lastErr = err
+			continue
+		}
+		BalancerReportSuccess(key, fwd, host)
+		return resp, nil
 	}
+	return nil, lastErr
+}
 
-	fLog.Debug().Str("messagetype", "ResponseBody").Msg(string(body))
+// forwardForgetState removes cached responses, balancer and circuit breaker state of forward with state key
+func forwardForgetState(stateKey string) {
+	CachePurge(stateKey)
+	BalancerForget(stateKey)
+	BreakerForget(stateKey)
+}
 
-	w.WriteHeader(resp.StatusCode)
-	w.Write(body)
+// doHTTPRequest forwards request and writes response to response writer. Returns written response or nil.
+// Cache, balancer and circuit breaker state is kept by stateKey, key is reported in logs and error body
+func doHTTPRequest(w http.ResponseWriter, stateKey string, key string, req *ExpectationRequest, fwd *ExpectationForward) *upstreamResponse {
+	fLog := log.With().Str("function", "doHTTPRequest").Logger()
+
+	upstreamResp := CacheGet(stateKey, req, fwd.Cache)
+	if upstreamResp == nil {
+		if BreakerIsOpen(stateKey, fwd.OnError) {
+			fLog.Info().Str("key", key).Msg("Circuit is open, fallback is used")
+			return writeForwardError(w, key, fwd, errCircuitOpen)
+		}
+
+		resp, err := sendToForwardTargets(stateKey, req, fwd)
+		if err == nil {
+			upstreamResp, err = readUpstreamResponse(resp, fwd.Decode || TransformModifiesBody(fwd.Transform))
+		}
+		if err != nil {
+			fLog.Error().Err(err).Str("key", key).Msg("Forward target is unavailable")
+			BreakerReportFailure(stateKey, fwd.OnError)
+			return writeForwardError(w, key, fwd, err)
+		}
+		BreakerReportSuccess(stateKey)
 
-	headers := *ControllerTranslateHTTPHeadersToExpHeaders(resp.Header)
-	for name, value := range headers {
-		w.Header().Set(name, value)
+		CachePut(stateKey, req, fwd.Cache, upstreamResp)
+		// cached response shouldn't be changed by transform
+		upstreamResp = cloneUpstreamResponse(upstreamResp)
+		if fwd.Cache != nil {
+			upstreamResp.Header.Set(cacheHeader, "MISS")
+		}
+	} else {
+		fLog.Info().Str("key", key).Msg("Response is taken from cache")
+		upstreamResp.Header.Set(cacheHeader, "HIT")
 	}
+
+	transformUpstreamResponse(upstreamResp, fwd.Transform)
+
+	fLog.Debug().Str("messagetype", "ResponseBody").Msg(string(upstreamResp.Body))
+
+	writeUpstreamResponse(w, upstreamResp)
+	return upstreamResp
 }
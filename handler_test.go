@@ -2,10 +2,14 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"net/url"
 
@@ -31,6 +35,67 @@ func addExpectation(t *testing.T, exp Expectation) *bytes.Buffer {
 	return httpTestResponseRecorder.Body
 }
 
+func removeExpectation(t *testing.T, key string) {
+	handlerRemoveExpectation := http.HandlerFunc(HandlerRemoveExpectation)
+
+	expRemoveJSON, err := json.Marshal(ExpectationRemove{Key: key})
+	if err != nil {
+		panic(err)
+	}
+	req, err := http.NewRequest("POST", "/gozzmock/remove_expectation", bytes.NewBuffer(expRemoveJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpTestResponseRecorder := httptest.NewRecorder()
+	handlerRemoveExpectation.ServeHTTP(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusOK, httpTestResponseRecorder.Code)
+}
+
+// forwardToTestServer adds forward expectation for path to test server and returns response for request to path
+func forwardToTestServer(t *testing.T, path string, fwd ExpectationForward, handler http.HandlerFunc) *http.Response {
+	testServer := httptest.NewServer(handler)
+	defer testServer.Close()
+	testServerURL, err := url.Parse(testServer.URL)
+	if err != nil {
+		panic(err)
+	}
+
+	fwd.Scheme = testServerURL.Scheme
+	fwd.Host = testServerURL.Host
+	exp := Expectation{
+		Key:      path,
+		Request:  &ExpectationRequest{Path: path},
+		Forward:  &fwd,
+		Priority: 10}
+	addExpectation(t, exp)
+	defer removeExpectation(t, exp.Key)
+
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpTestResponseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(HandlerDefault).ServeHTTP(httpTestResponseRecorder, req)
+	return httpTestResponseRecorder.Result()
+}
+
+// handleRequest serves request with method, url, body and headers by handler and returns recorded response
+func handleRequest(t *testing.T, handler http.HandlerFunc, method string, url string, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.RequestURI = req.URL.RequestURI()
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	httpTestResponseRecorder := httptest.NewRecorder()
+	handler.ServeHTTP(httpTestResponseRecorder, req)
+	return httpTestResponseRecorder
+}
+
 func TestHandlerNoExpectations(t *testing.T) {
 	handlerDefault := http.HandlerFunc(HandlerDefault)
 	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -52,7 +117,7 @@ func TestHandlerNoExpectations(t *testing.T) {
 
 func TestHandlerAddAndRemoveExpectation(t *testing.T) {
 	handlerRemoveExpectation := http.HandlerFunc(HandlerRemoveExpectation)
-	expectedExp := Expectation{Key: "k"}
+	expectedExp := Expectation{Key: "k", Response: &ExpectationResponse{HTTPCode: http.StatusOK}}
 	expectedExps := Expectations{expectedExp.Key: expectedExp}
 
 	body := addExpectation(t, expectedExp)
@@ -100,6 +165,8 @@ func TestHandlerAddTwoExpectations(t *testing.T) {
 		Key:      "forward",
 		Forward:  &ExpectationForward{Scheme: testServerURL.Scheme, Host: testServerURL.Host},
 		Priority: 0})
+	defer removeExpectation(t, "response")
+	defer removeExpectation(t, "forward")
 
 	// do request for response
 	req, err := http.NewRequest("POST", "/response", bytes.NewBuffer([]byte("request body")))
@@ -139,6 +206,7 @@ func TestHandlerGetExpectations(t *testing.T) {
 		Response: &ExpectationResponse{HTTPCode: http.StatusOK, Body: "response body"},
 		Priority: 1}
 	addExpectation(t, expectation)
+	defer removeExpectation(t, "response")
 
 	// do request for response
 	req, err := http.NewRequest("GET", "/gozzmock/get_expectations", nil)
@@ -176,3 +244,1067 @@ func TestHandlerStatus(t *testing.T) {
 	assert.Equal(t, http.StatusOK, httpTestResponseRecorder.Code)
 	assert.Contains(t, "gozzmock status is OK", httpTestResponseRecorder.Body.String())
 }
+
+func TestHandlerForwardStatusAndMultiValueHeaders(t *testing.T) {
+	resp := forwardToTestServer(t, "/forward_headers", ExpectationForward{},
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Multi", "v1")
+			w.Header().Add("X-Multi", "v2")
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("created"))
+		})
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, []string{"v1", "v2"}, resp.Header["X-Multi"])
+	assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "created", string(body))
+}
+
+func TestHandlerForwardTrailers(t *testing.T) {
+	resp := forwardToTestServer(t, "/forward_trailers", ExpectationForward{},
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Trailer", "X-Checksum")
+			w.Write([]byte("body with trailer"))
+			w.Header().Set("X-Checksum", "abc")
+		})
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "body with trailer", string(body))
+	assert.Equal(t, "abc", resp.Trailer.Get("X-Checksum"))
+	assert.Empty(t, resp.Header.Get("X-Checksum"))
+}
+
+func gzipHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Encoding", "gzip")
+	gzipWriter := gzip.NewWriter(w)
+	gzipWriter.Write([]byte("gzipped body"))
+	gzipWriter.Close()
+}
+
+func deflateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Encoding", "deflate")
+	zlibWriter := zlib.NewWriter(w)
+	zlibWriter.Write([]byte("deflated body"))
+	zlibWriter.Close()
+}
+
+func TestHandlerForwardGzipPassThrough(t *testing.T) {
+	resp := forwardToTestServer(t, "/forward_gzip_raw", ExpectationForward{}, gzipHandler)
+
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	reader, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "gzipped body", string(body))
+}
+
+func TestHandlerForwardGzipDecode(t *testing.T) {
+	resp := forwardToTestServer(t, "/forward_gzip_decoded", ExpectationForward{Decode: true}, gzipHandler)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "gzipped body", string(body))
+}
+
+func TestHandlerForwardDeflatePassThrough(t *testing.T) {
+	resp := forwardToTestServer(t, "/forward_deflate_raw", ExpectationForward{}, deflateHandler)
+
+	assert.Equal(t, "deflate", resp.Header.Get("Content-Encoding"))
+	reader, err := zlib.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "deflated body", string(body))
+}
+
+func TestHandlerForwardDeflateDecode(t *testing.T) {
+	resp := forwardToTestServer(t, "/forward_deflate_decoded", ExpectationForward{Decode: true}, deflateHandler)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "deflated body", string(body))
+}
+
+func TestHandlerResponseHeaders(t *testing.T) {
+	exp := Expectation{
+		Key:      "response_headers",
+		Request:  &ExpectationRequest{Path: "/response_headers"},
+		Response: &ExpectationResponse{HTTPCode: http.StatusAccepted, Body: "accepted", Headers: &Headers{"X-Mock": "yes"}},
+		Priority: 10}
+	addExpectation(t, exp)
+	defer removeExpectation(t, exp.Key)
+
+	req, err := http.NewRequest("GET", "/response_headers", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpTestResponseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(HandlerDefault).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusAccepted, httpTestResponseRecorder.Code)
+	assert.Equal(t, "yes", httpTestResponseRecorder.Header().Get("X-Mock"))
+	assert.Equal(t, "accepted", httpTestResponseRecorder.Body.String())
+}
+
+func TestHandlerForwardTransformGzipBody(t *testing.T) {
+	resp := forwardToTestServer(t, "/forward_transform",
+		ExpectationForward{Transform: &ExpectationTransform{
+			HTTPCode: http.StatusPaymentRequired,
+			Set:      []ExpectationJSONPathSet{{Path: "$.balance", Value: json.RawMessage(`0`)}}}},
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "gzip")
+			gzipWriter := gzip.NewWriter(w)
+			gzipWriter.Write([]byte(`{"balance":100,"currency":"EUR"}`))
+			gzipWriter.Close()
+		})
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusPaymentRequired, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	assert.JSONEq(t, `{"balance":0,"currency":"EUR"}`, string(body))
+}
+
+func TestHandlerForwardToSeveralHosts_DeadHostEjected(t *testing.T) {
+	deadServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	deadServerURL, err := url.Parse(deadServer.URL)
+	if err != nil {
+		panic(err)
+	}
+	deadServer.Close()
+
+	liveServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("response from live server"))
+	}))
+	defer liveServer.Close()
+	liveServerURL, err := url.Parse(liveServer.URL)
+	if err != nil {
+		panic(err)
+	}
+
+	exp := Expectation{
+		Key:     "forward_hosts",
+		Request: &ExpectationRequest{Path: "/forward_hosts"},
+		Forward: &ExpectationForward{
+			Scheme:   "http",
+			Hosts:    []string{deadServerURL.Host, liveServerURL.Host},
+			Strategy: BalancerRoundRobin,
+			MaxFails: 1},
+		Priority: 10}
+	addExpectation(t, exp)
+	defer removeExpectation(t, exp.Key)
+
+	for i := 0; i < 3; i++ {
+		req, err := http.NewRequest("GET", "/forward_hosts", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		httpTestResponseRecorder := httptest.NewRecorder()
+		http.HandlerFunc(HandlerDefault).ServeHTTP(httpTestResponseRecorder, req)
+		assert.Equal(t, http.StatusOK, httpTestResponseRecorder.Code)
+		assert.Equal(t, "response from live server", httpTestResponseRecorder.Body.String())
+	}
+
+	assert.Equal(t, []string{liveServerURL.Host, deadServerURL.Host}, BalancerOrderHosts(exp.Key, exp.Forward))
+}
+
+func TestHandlerMirror_DifferentResponses_DiffRecorded(t *testing.T) {
+	MirrorResetDiffs("")
+	defer MirrorResetDiffs("")
+
+	mirrorServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":1,"name":"real"}`))
+	}))
+	defer mirrorServer.Close()
+	mirrorServerURL, err := url.Parse(mirrorServer.URL)
+	if err != nil {
+		panic(err)
+	}
+
+	exp := Expectation{
+		Key:      "mirror",
+		Request:  &ExpectationRequest{Path: "/mirror"},
+		Response: &ExpectationResponse{HTTPCode: http.StatusOK, Body: `{"id":1,"name":"mock"}`},
+		Mirror:   &ExpectationMirror{Scheme: mirrorServerURL.Scheme, Host: mirrorServerURL.Host, IgnoreHeaders: []string{"Content-Type"}},
+		Priority: 10}
+	addExpectation(t, exp)
+	defer removeExpectation(t, exp.Key)
+
+	req, err := http.NewRequest("GET", "/mirror", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpTestResponseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(HandlerDefault).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Equal(t, `{"id":1,"name":"mock"}`, httpTestResponseRecorder.Body.String())
+
+	var diffs []MirrorDiff
+	for i := 0; i < 100 && len(diffs) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		diffs = MirrorGetDiffs("")
+	}
+
+	assert.Len(t, diffs, 1)
+	assert.Equal(t, "mirror", diffs[0].Key)
+	assert.Equal(t, "/mirror", diffs[0].Path)
+	assert.Equal(t, []MirrorDifference{{Field: "body.name", Primary: "mock", Mirror: "real"}}, diffs[0].Differences)
+
+	req, err = http.NewRequest("GET", "/gozzmock/get_mirror_diffs", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpTestResponseRecorder = httptest.NewRecorder()
+	http.HandlerFunc(HandlerGetMirrorDiffs).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusOK, httpTestResponseRecorder.Code)
+	assert.Contains(t, httpTestResponseRecorder.Body.String(), `"field":"body.name"`)
+}
+
+func TestHandlerUnmatched_NotFoundWithBody(t *testing.T) {
+	assert.NoError(t, UnmatchedSet(Unmatched{Action: UnmatchedNotFound, Body: "not mocked"}))
+	defer UnmatchedSet(Unmatched{})
+
+	req, err := http.NewRequest("GET", "/unmatched_not_found", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = "unmatched.host"
+
+	httpTestResponseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(HandlerDefault).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusNotFound, httpTestResponseRecorder.Code)
+	assert.Equal(t, "not mocked", httpTestResponseRecorder.Body.String())
+}
+
+func TestHandlerUnmatched_ForwardByHost(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("response from origin " + r.URL.Path))
+	}))
+	defer testServer.Close()
+	testServerURL, err := url.Parse(testServer.URL)
+	if err != nil {
+		panic(err)
+	}
+
+	assert.NoError(t, UnmatchedSet(Unmatched{
+		Action: UnmatchedForward,
+		Hosts:  map[string]string{"mapped.host": testServerURL.Host}}))
+	defer UnmatchedSet(Unmatched{})
+
+	for _, host := range []string{testServerURL.Host, "mapped.host"} {
+		req, err := http.NewRequest("GET", "/unmatched_forward", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = host
+
+		httpTestResponseRecorder := httptest.NewRecorder()
+		http.HandlerFunc(HandlerDefault).ServeHTTP(httpTestResponseRecorder, req)
+		assert.Equal(t, http.StatusOK, httpTestResponseRecorder.Code)
+		assert.Equal(t, "response from origin /unmatched_forward", httpTestResponseRecorder.Body.String())
+	}
+}
+
+func TestHandlerUnmatched_Forward_ExpectationStateNotShared(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("response from origin"))
+	}))
+	defer testServer.Close()
+	testServerURL, err := url.Parse(testServer.URL)
+	if err != nil {
+		panic(err)
+	}
+	assert.NoError(t, UnmatchedSet(Unmatched{Action: UnmatchedForward}))
+	defer UnmatchedSet(Unmatched{})
+
+	// circuit of expectation with key "unmatched" is open
+	onError := &ExpectationOnError{Threshold: 1, CoolDown: 10}
+	BreakerReportFailure(unmatchedStateName, onError)
+	defer BreakerForget(unmatchedStateName)
+
+	req, err := http.NewRequest("GET", "/unmatched_state", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = testServerURL.Host
+	httpTestResponseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(HandlerDefault).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Equal(t, "response from origin", httpTestResponseRecorder.Body.String())
+	assert.True(t, BreakerIsOpen(unmatchedStateName, onError))
+}
+
+func TestHandlerUnmatched_ForwardLoop_LoopDetected(t *testing.T) {
+	assert.NoError(t, UnmatchedSet(Unmatched{Action: UnmatchedForward}))
+	defer UnmatchedSet(Unmatched{})
+
+	req, err := http.NewRequest("GET", "/unmatched_loop", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Via", unmatchedVia)
+
+	httpTestResponseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(HandlerDefault).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusLoopDetected, httpTestResponseRecorder.Code)
+}
+
+func TestHandlerUnmatched_GetAndSet(t *testing.T) {
+	defer UnmatchedSet(Unmatched{})
+
+	req, err := http.NewRequest("POST", "/gozzmock/unmatched", bytes.NewBufferString(`{"action":"notfound","body":"b"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpTestResponseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(HandlerUnmatched).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusOK, httpTestResponseRecorder.Code)
+	assert.JSONEq(t, `{"action":"notfound","body":"b"}`, httpTestResponseRecorder.Body.String())
+
+	req, err = http.NewRequest("POST", "/gozzmock/unmatched", bytes.NewBufferString(`{"action":"wrong"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpTestResponseRecorder = httptest.NewRecorder()
+	http.HandlerFunc(HandlerUnmatched).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, httpTestResponseRecorder.Code)
+
+	req, err = http.NewRequest("GET", "/gozzmock/unmatched", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpTestResponseRecorder = httptest.NewRecorder()
+	http.HandlerFunc(HandlerUnmatched).ServeHTTP(httpTestResponseRecorder, req)
+	assert.JSONEq(t, `{"action":"notfound","body":"b"}`, httpTestResponseRecorder.Body.String())
+}
+
+func TestHandlerForwardCache_SecondRequestFromCache(t *testing.T) {
+	defer CachePurge("forward_cache")
+
+	upstreamCalls := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+		w.Write([]byte("slow response"))
+	}))
+	defer testServer.Close()
+	testServerURL, err := url.Parse(testServer.URL)
+	if err != nil {
+		panic(err)
+	}
+
+	exp := Expectation{
+		Key:     "forward_cache",
+		Request: &ExpectationRequest{Path: "/forward_cache"},
+		Forward: &ExpectationForward{
+			Scheme:    testServerURL.Scheme,
+			Host:      testServerURL.Host,
+			Cache:     &ExpectationCache{TTL: 10},
+			Transform: &ExpectationTransform{Replace: []ExpectationReplace{{Regex: "slow", Replacement: "fast"}}}},
+		Priority: 10}
+	addExpectation(t, exp)
+	defer removeExpectation(t, exp.Key)
+
+	for _, cacheStatus := range []string{"MISS", "HIT"} {
+		req, err := http.NewRequest("GET", "/forward_cache", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpTestResponseRecorder := httptest.NewRecorder()
+		http.HandlerFunc(HandlerDefault).ServeHTTP(httpTestResponseRecorder, req)
+		assert.Equal(t, "fast response", httpTestResponseRecorder.Body.String())
+		assert.Equal(t, cacheStatus, httpTestResponseRecorder.Header().Get(cacheHeader))
+	}
+	assert.Equal(t, 1, upstreamCalls)
+
+	req, err := http.NewRequest("GET", "/gozzmock/get_cache?key=forward_cache", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpTestResponseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(HandlerGetCache).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Contains(t, httpTestResponseRecorder.Body.String(), `"path":"/forward_cache"`)
+
+	req, err = http.NewRequest("POST", "/gozzmock/purge_cache", bytes.NewBufferString(`{"key":"forward_cache"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpTestResponseRecorder = httptest.NewRecorder()
+	http.HandlerFunc(HandlerPurgeCache).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusOK, httpTestResponseRecorder.Code)
+	assert.Empty(t, CacheGetEntries("", "forward_cache"))
+}
+
+func TestHandlerCache_Namespace_Isolated(t *testing.T) {
+	assert.NoError(t, NamespaceCreate("cache_team"))
+	defer NamespaceDelete("cache_team")
+	defer CachePurge("cache_ns")
+	cache := &ExpectationCache{}
+	req := &ExpectationRequest{Method: "GET", Path: "/cache_ns"}
+	CachePut("cache_ns", req, cache, cacheTestResponse("default"))
+	CachePut(NamespaceStateKey("cache_team", "cache_ns"), req, cache, cacheTestResponse("team"))
+	team := map[string]string{namespaceHeader: "cache_team"}
+
+	recorder := handleRequest(t, HandlerGetCache, "GET", "/gozzmock/get_cache?key=cache_ns", "", team)
+	entries := []CacheEntry{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &entries))
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "cache_ns", entries[0].Key)
+
+	recorder = handleRequest(t, HandlerGetCache, "GET", "/gozzmock/get_cache", "", nil)
+	assert.NotContains(t, recorder.Body.String(), "cache_team")
+
+	recorder = handleRequest(t, HandlerPurgeCache, "POST", "/gozzmock/purge_cache", `{"key":"cache_ns"}`, team)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, CacheGetEntries("cache_team", ""))
+	assert.Len(t, CacheGetEntries("", "cache_ns"), 1)
+
+	recorder = handleRequest(t, HandlerGetCache, "GET", "/gozzmock/get_cache", "", map[string]string{namespaceHeader: "missing"})
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestHandlerForwardCache_RemovedAndAddedAgain_NewTarget(t *testing.T) {
+	defer CachePurge("forward_readded")
+
+	targets := map[string]*url.URL{}
+	for _, body := range []string{"A", "B"} {
+		body := body
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}))
+		defer testServer.Close()
+		testServerURL, err := url.Parse(testServer.URL)
+		if err != nil {
+			panic(err)
+		}
+		targets[body] = testServerURL
+	}
+	forwardTo := func(target string) Expectation {
+		return Expectation{
+			Key:     "forward_readded",
+			Request: &ExpectationRequest{Path: "/forward_readded"},
+			Forward: &ExpectationForward{
+				Scheme: targets[target].Scheme,
+				Host:   targets[target].Host,
+				Cache:  &ExpectationCache{TTL: 10}},
+			Priority: 10}
+	}
+
+	addExpectation(t, forwardTo("A"))
+	recorder := handleRequest(t, HandlerDefault, "GET", "/forward_readded", "", nil)
+	assert.Equal(t, "A", recorder.Body.String())
+
+	removeExpectation(t, "forward_readded")
+	addExpectation(t, forwardTo("B"))
+	defer removeExpectation(t, "forward_readded")
+	recorder = handleRequest(t, HandlerDefault, "GET", "/forward_readded", "", nil)
+	assert.Equal(t, "B", recorder.Body.String())
+	assert.Equal(t, "MISS", recorder.Header().Get(cacheHeader))
+
+	// replaced without removal
+	addExpectation(t, forwardTo("A"))
+	recorder = handleRequest(t, HandlerDefault, "GET", "/forward_readded", "", nil)
+	assert.Equal(t, "A", recorder.Body.String())
+}
+
+func TestHandlerForwardCircuitOpen_ExpectationReplaced_NewTargetUsed(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("new target"))
+	}))
+	defer testServer.Close()
+	testServerURL, err := url.Parse(testServer.URL)
+	if err != nil {
+		panic(err)
+	}
+
+	exp := Expectation{
+		Key:     "forward_breaker_replaced",
+		Request: &ExpectationRequest{Path: "/forward_breaker_replaced"},
+		Forward: &ExpectationForward{Scheme: "http", Host: closedServerHost(), OnError: &ExpectationOnError{
+			Response:  &ExpectationResponse{HTTPCode: http.StatusOK, Body: "fallback"},
+			Threshold: 1,
+			CoolDown:  10}},
+		Priority: 10}
+	addExpectation(t, exp)
+	defer removeExpectation(t, exp.Key)
+	recorder := handleRequest(t, HandlerDefault, "GET", "/forward_breaker_replaced", "", nil)
+	assert.Equal(t, "fallback", recorder.Body.String())
+	assert.True(t, BreakerIsOpen(exp.Key, exp.Forward.OnError))
+
+	exp.Forward.Host = testServerURL.Host
+	addExpectation(t, exp)
+	assert.False(t, BreakerIsOpen(exp.Key, exp.Forward.OnError))
+	recorder = handleRequest(t, HandlerDefault, "GET", "/forward_breaker_replaced", "", nil)
+	assert.Equal(t, "new target", recorder.Body.String())
+}
+
+// closedServerHost returns address where nobody listens
+func closedServerHost() string {
+	deadServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	deadServerURL, err := url.Parse(deadServer.URL)
+	if err != nil {
+		panic(err)
+	}
+	deadServer.Close()
+	return deadServerURL.Host
+}
+
+func TestHandlerForwardTargetDown_BadGateway(t *testing.T) {
+	exp := Expectation{
+		Key:      "forward_down",
+		Request:  &ExpectationRequest{Path: "/forward_down"},
+		Forward:  &ExpectationForward{Scheme: "http", Host: closedServerHost()},
+		Priority: 10}
+	addExpectation(t, exp)
+	defer removeExpectation(t, exp.Key)
+
+	req, err := http.NewRequest("GET", "/forward_down", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpTestResponseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(HandlerDefault).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusBadGateway, httpTestResponseRecorder.Code)
+	assert.Contains(t, httpTestResponseRecorder.Body.String(), `"key":"forward_down"`)
+}
+
+func TestHandlerForwardTargetDown_CircuitOpenFallback(t *testing.T) {
+	defer BreakerReportSuccess("forward_breaker")
+
+	exp := Expectation{
+		Key:     "forward_breaker",
+		Request: &ExpectationRequest{Path: "/forward_breaker"},
+		Forward: &ExpectationForward{Scheme: "http", Host: closedServerHost(), OnError: &ExpectationOnError{
+			Response:  &ExpectationResponse{HTTPCode: http.StatusOK, Body: "fallback"},
+			Threshold: 1,
+			CoolDown:  10}},
+		Priority: 10}
+	addExpectation(t, exp)
+	defer removeExpectation(t, exp.Key)
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest("GET", "/forward_breaker", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpTestResponseRecorder := httptest.NewRecorder()
+		http.HandlerFunc(HandlerDefault).ServeHTTP(httpTestResponseRecorder, req)
+		assert.Equal(t, http.StatusOK, httpTestResponseRecorder.Code)
+		assert.Equal(t, "fallback", httpTestResponseRecorder.Body.String())
+		assert.True(t, BreakerIsOpen(exp.Key, exp.Forward.OnError))
+	}
+}
+
+func TestHandlerGetRequests_MatchedAndUnmatched(t *testing.T) {
+	JournalReset()
+	defer JournalReset()
+
+	exp := Expectation{
+		Key:      "journal",
+		Request:  &ExpectationRequest{Path: "/journal_matched"},
+		Response: &ExpectationResponse{HTTPCode: http.StatusOK, Body: "journal response"},
+		Priority: 10}
+	addExpectation(t, exp)
+	defer removeExpectation(t, exp.Key)
+
+	for _, path := range []string{"/journal_matched", "/journal_unmatched"} {
+		req, err := http.NewRequest("POST", path, bytes.NewBufferString("journal body"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		http.HandlerFunc(HandlerDefault).ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	req, err := http.NewRequest("GET", "/gozzmock/requests?path=journal&method=POST", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpTestResponseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(HandlerGetRequests).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusOK, httpTestResponseRecorder.Code)
+
+	entries := []JournalEntry{}
+	assert.NoError(t, json.Unmarshal(httpTestResponseRecorder.Body.Bytes(), &entries))
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "journal", entries[0].Key)
+	assert.Equal(t, "journal body", entries[0].Request.Body)
+	assert.Equal(t, "journal response", entries[0].Response.Body)
+	assert.Equal(t, "", entries[1].Key)
+	assert.Equal(t, http.StatusNotImplemented, entries[1].Response.HTTPCode)
+
+	req, err = http.NewRequest("GET", "/gozzmock/requests?unmatched=true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpTestResponseRecorder = httptest.NewRecorder()
+	http.HandlerFunc(HandlerGetRequests).ServeHTTP(httpTestResponseRecorder, req)
+	assert.NoError(t, json.Unmarshal(httpTestResponseRecorder.Body.Bytes(), &entries))
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "/journal_unmatched", entries[0].Request.Path)
+
+	req, err = http.NewRequest("GET", "/gozzmock/requests?limit=x", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpTestResponseRecorder = httptest.NewRecorder()
+	http.HandlerFunc(HandlerGetRequests).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusBadRequest, httpTestResponseRecorder.Code)
+}
+
+func TestHandlerVerify_PassedAndFailed(t *testing.T) {
+	JournalReset()
+	defer JournalReset()
+
+	req, err := http.NewRequest("GET", "/verify_me", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	http.HandlerFunc(HandlerDefault).ServeHTTP(httptest.NewRecorder(), req)
+
+	req, err = http.NewRequest("POST", "/gozzmock/verify", bytes.NewBufferString(`{"request":{"path":"/verify_me"},"exactly":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpTestResponseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(HandlerVerify).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusOK, httpTestResponseRecorder.Code)
+	assert.Contains(t, httpTestResponseRecorder.Body.String(), `"passed":true`)
+
+	req, err = http.NewRequest("POST", "/gozzmock/verify_sequence", bytes.NewBufferString(`{"requests":[{"path":"/verify_me"},{"path":"/verify_me"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpTestResponseRecorder = httptest.NewRecorder()
+	http.HandlerFunc(HandlerVerifySequence).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusNotAcceptable, httpTestResponseRecorder.Code)
+	assert.Contains(t, httpTestResponseRecorder.Body.String(), `"passed":false`)
+}
+
+func TestHandlerExplain_HeaderAndEndpoint(t *testing.T) {
+	JournalReset()
+	defer JournalReset()
+
+	exp := Expectation{
+		Key:      "explain",
+		Request:  &ExpectationRequest{Method: "POST", Path: "/explain_me"},
+		Response: &ExpectationResponse{HTTPCode: http.StatusOK},
+		Priority: 10}
+	addExpectation(t, exp)
+	defer removeExpectation(t, exp.Key)
+
+	req, err := http.NewRequest("GET", "/explain_me", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(explainHeader, "true")
+	httpTestResponseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(HandlerDefault).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusNotImplemented, httpTestResponseRecorder.Code)
+
+	explanation := Explanation{}
+	assert.NoError(t, json.Unmarshal(httpTestResponseRecorder.Body.Bytes(), &explanation))
+	assert.Equal(t, "No expectations in gozzmock for request!", explanation.Message)
+	assert.Equal(t, "explain", explanation.NearMisses[0].Key)
+	assert.Equal(t, "method", explanation.NearMisses[0].Mismatches[0].Field)
+
+	req, err = http.NewRequest("GET", "/gozzmock/explain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpTestResponseRecorder = httptest.NewRecorder()
+	http.HandlerFunc(HandlerExplain).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusOK, httpTestResponseRecorder.Code)
+	explanation = Explanation{}
+	assert.NoError(t, json.Unmarshal(httpTestResponseRecorder.Body.Bytes(), &explanation))
+	assert.Equal(t, "/explain_me", explanation.Request.Path)
+	assert.Equal(t, "explain", explanation.NearMisses[0].Key)
+
+	req, err = http.NewRequest("POST", "/gozzmock/explain", bytes.NewBufferString(`{"method":"PUT","path":"/explain_me"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpTestResponseRecorder = httptest.NewRecorder()
+	http.HandlerFunc(HandlerExplain).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Contains(t, httpTestResponseRecorder.Body.String(), `"reason":"method PUT should be POST"`)
+
+	req, err = http.NewRequest("GET", "/gozzmock/explain?id=100000", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpTestResponseRecorder = httptest.NewRecorder()
+	http.HandlerFunc(HandlerExplain).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusNotFound, httpTestResponseRecorder.Code)
+}
+
+func TestHandlerHAR_ExportAndImport(t *testing.T) {
+	JournalReset()
+	defer JournalReset()
+
+	req, err := http.NewRequest("GET", "/har_export", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	http.HandlerFunc(HandlerDefault).ServeHTTP(httptest.NewRecorder(), req)
+
+	req, err = http.NewRequest("GET", "/gozzmock/har?path=har_export", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpTestResponseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(HandlerGetHAR).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusOK, httpTestResponseRecorder.Code)
+
+	har := HAR{}
+	assert.NoError(t, json.Unmarshal(httpTestResponseRecorder.Body.Bytes(), &har))
+	assert.Len(t, har.Log.Entries, 1)
+	assert.Equal(t, http.StatusNotImplemented, har.Log.Entries[0].Response.Status)
+
+	// import the exported archive with changed response
+	har.Log.Entries[0].Response.Status = http.StatusOK
+	har.Log.Entries[0].Response.Content.Text = "from har"
+	harJSON, err := json.Marshal(har)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err = http.NewRequest("POST", "/gozzmock/import_har?prefix=har_test&priority=10", bytes.NewBuffer(harJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpTestResponseRecorder = httptest.NewRecorder()
+	http.HandlerFunc(HandlerImportHAR).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusOK, httpTestResponseRecorder.Code)
+	defer removeExpectation(t, "har_test_0")
+
+	req, err = http.NewRequest("GET", "/har_export", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpTestResponseRecorder = httptest.NewRecorder()
+	http.HandlerFunc(HandlerDefault).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusOK, httpTestResponseRecorder.Code)
+	assert.Equal(t, "from har", httpTestResponseRecorder.Body.String())
+}
+
+func TestHandlerImportHAR_InvalidStatus_Rejected(t *testing.T) {
+	defer ControllerResetExpectations(nil)
+	ControllerResetExpectations(nil)
+
+	recorder := handleRequest(t, HandlerImportHAR, "POST", "/gozzmock/import_har?prefix=har_invalid", `{"log": {"entries": [
+		{"request": {"method": "GET", "url": "http://host/ok"}, "response": {"status": 200}},
+		{"request": {"method": "GET", "url": "http://host/bad"}, "response": {"status": -5}}]}}`, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.JSONEq(t, `{"status":422,"message":"expectations are invalid","fields":[{"field":"[1].response.httpcode","message":"HTTP code -5 should be between 100 and 599"}]}`, recorder.Body.String())
+	assert.Empty(t, ControllerGetExpectations(nil))
+}
+
+func TestHandlerAddExpectation_WrongRequests_StructuredErrors(t *testing.T) {
+	cases := []struct {
+		method string
+		body   string
+		code   int
+	}{
+		{"GET", "", http.StatusMethodNotAllowed},
+		{"POST", `{"key":`, http.StatusBadRequest},
+		{"POST", `{"key":"k","priority":"high"}`, http.StatusBadRequest},
+		{"POST", `{"response":{"httpcode":200}}`, http.StatusUnprocessableEntity},
+	}
+	for _, c := range cases {
+		req, err := http.NewRequest(c.method, "/gozzmock/add_expectation", bytes.NewBufferString(c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpTestResponseRecorder := httptest.NewRecorder()
+		http.HandlerFunc(HandlerAddExpectation).ServeHTTP(httpTestResponseRecorder, req)
+		assert.Equal(t, c.code, httpTestResponseRecorder.Code, c.body)
+
+		apiErr := APIError{}
+		assert.NoError(t, json.Unmarshal(httpTestResponseRecorder.Body.Bytes(), &apiErr))
+		assert.Equal(t, c.code, apiErr.Status)
+		assert.NotEmpty(t, apiErr.Message)
+	}
+}
+
+func TestHandlerRemoveExpectation_NoKey_Unprocessable(t *testing.T) {
+	req, err := http.NewRequest("POST", "/gozzmock/remove_expectation", bytes.NewBufferString(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpTestResponseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(HandlerRemoveExpectation).ServeHTTP(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, httpTestResponseRecorder.Code)
+	assert.JSONEq(t, `{"status":422,"message":"expectation key is invalid","fields":[{"field":"key","message":"key is required"}]}`, httpTestResponseRecorder.Body.String())
+}
+
+func TestHandlerBulkExpectations_AddRemoveReset(t *testing.T) {
+	defer ControllerResetExpectations(nil)
+
+	recorder := handleRequest(t, HandlerAddExpectations, "POST", "/gozzmock/add_expectations", `[
+		{"key": "bulk_a", "response": {"httpcode": 200}},
+		{"key": "bulk_b", "response": {"httpcode": 201}},
+		{"key": "other", "response": {"httpcode": 202}}]`, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, 3, len(ControllerGetExpectations(nil)))
+
+	// invalid expectation in the list, nothing is added
+	recorder = handleRequest(t, HandlerAddExpectations, "POST", "/gozzmock/add_expectations", `[
+		{"key": "bulk_c", "response": {"httpcode": 200}},
+		{"key": "bulk_d"}]`, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.NotContains(t, ControllerGetExpectations(nil), "bulk_c")
+
+	recorder = handleRequest(t, HandlerRemoveExpectations, "POST", "/gozzmock/remove_expectations", `{"key": "^bulk_"}`, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `["bulk_a","bulk_b"]`, recorder.Body.String())
+	assert.Equal(t, 1, len(ControllerGetExpectations(nil)))
+
+	recorder = handleRequest(t, HandlerRemoveExpectations, "POST", "/gozzmock/remove_expectations", `{"key": "("}`, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	recorder = handleRequest(t, HandlerRemoveExpectations, "POST", "/gozzmock/remove_expectations", `{}`, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+
+	recorder = handleRequest(t, HandlerAddExpectations, "POST", "/gozzmock/add_expectations?reset=true", `[{"key": "bulk_e", "response": {"httpcode": 200}}]`, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, 1, len(ControllerGetExpectations(nil)))
+	assert.Contains(t, ControllerGetExpectations(nil), "bulk_e")
+
+	recorder = handleRequest(t, HandlerResetExpectations, "POST", "/gozzmock/reset_expectations", "", nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "{}", recorder.Body.String())
+	assert.Empty(t, ControllerGetExpectations(nil))
+}
+
+func TestHandlerExpectations_RESTfulAPI(t *testing.T) {
+	defer ControllerResetExpectations(nil)
+	ControllerResetExpectations(nil)
+
+	recorder := handleRequest(t, HandlerExpectations, "GET", "/gozzmock/expectations/rest", "", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	// create
+	recorder = handleRequest(t, HandlerExpectations, "PUT", "/gozzmock/expectations/rest", `{"response":{"httpcode":200,"body":"v1"}}`, map[string]string{"If-None-Match": "*"})
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	etag := recorder.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.JSONEq(t, `{"key":"rest","response":{"httpcode":200,"body":"v1"}}`, recorder.Body.String())
+
+	recorder = handleRequest(t, HandlerExpectations, "PUT", "/gozzmock/expectations/rest", `{"response":{"httpcode":200}}`, map[string]string{"If-None-Match": "*"})
+	assert.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+
+	recorder = handleRequest(t, HandlerExpectations, "GET", "/gozzmock/expectations/rest", "", nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, etag, recorder.Header().Get("ETag"))
+
+	recorder = handleRequest(t, HandlerExpectations, "GET", "/gozzmock/expectations/rest", "", map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusNotModified, recorder.Code)
+
+	// patch with current ETag
+	recorder = handleRequest(t, HandlerExpectations, "PATCH", "/gozzmock/expectations/rest", `{"response":{"body":"v2"},"priority":3}`, map[string]string{"If-Match": etag})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"key":"rest","response":{"httpcode":200,"body":"v2"},"priority":3}`, recorder.Body.String())
+	assert.NotEqual(t, etag, recorder.Header().Get("ETag"))
+
+	// outdated ETag
+	recorder = handleRequest(t, HandlerExpectations, "PUT", "/gozzmock/expectations/rest", `{"response":{"httpcode":500}}`, map[string]string{"If-Match": etag})
+	assert.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+	exp, _ := ControllerGetExpectation("rest", nil)
+	assert.Equal(t, "v2", exp.Response.Body)
+
+	recorder = handleRequest(t, HandlerExpectations, "PUT", "/gozzmock/expectations/rest", `{"key":"other","response":{"httpcode":200}}`, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+
+	recorder = handleRequest(t, HandlerExpectations, "PATCH", "/gozzmock/expectations/rest", `{"response":null}`, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+
+	recorder = handleRequest(t, HandlerExpectations, "PATCH", "/gozzmock/expectations/missing", `{"priority":1}`, nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	// list
+	recorder = handleRequest(t, HandlerExpectations, "PUT", "/gozzmock/expectations/rest2", `{"response":{"httpcode":200}}`, nil)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	recorder = handleRequest(t, HandlerExpectations, "GET", "/gozzmock/expectations?offset=1&limit=1", "", nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	page := ExpectationsPage{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &page))
+	assert.Equal(t, 2, page.Total)
+	assert.Equal(t, 1, page.Offset)
+	assert.Len(t, page.Expectations, 1)
+	assert.Equal(t, "rest2", page.Expectations[0].Key)
+
+	recorder = handleRequest(t, HandlerExpectations, "GET", "/gozzmock/expectations?limit=-1", "", nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = handleRequest(t, HandlerExpectations, "POST", "/gozzmock/expectations", "", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+
+	// delete
+	recorder = handleRequest(t, HandlerExpectations, "DELETE", "/gozzmock/expectations/rest", "", nil)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	recorder = handleRequest(t, HandlerExpectations, "DELETE", "/gozzmock/expectations/rest", "", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	recorder = handleRequest(t, HandlerExpectations, "POST", "/gozzmock/expectations/rest2", "", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestHandlerExpectations_Labels_FilteredAndRemoved(t *testing.T) {
+	defer ControllerResetExpectations(nil)
+	ControllerResetExpectations(nil)
+
+	recorder := handleRequest(t, HandlerAddExpectations, "POST", "/gozzmock/add_expectations", `[
+		{"key": "a", "response": {"httpcode": 200}, "labels": {"suite": "checkout"}},
+		{"key": "b", "response": {"httpcode": 200}, "labels": {"suite": "login"}},
+		{"key": "c", "response": {"httpcode": 200}}]`, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = handleRequest(t, HandlerGetExpectations, "GET", "/gozzmock/get_expectations?labels=suite=checkout", "", nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	exps := Expectations{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &exps))
+	assert.Equal(t, 1, len(exps))
+	assert.Contains(t, exps, "a")
+
+	recorder = handleRequest(t, HandlerExpectations, "GET", "/gozzmock/expectations?labels=!suite", "", nil)
+	page := ExpectationsPage{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &page))
+	assert.Equal(t, 1, page.Total)
+	assert.Equal(t, "c", page.Expectations[0].Key)
+
+	JournalReset()
+	defer JournalReset()
+	handleRequest(t, HandlerDefault, "GET", "/labels", "", nil)
+	entries := JournalGet(JournalFilter{})
+	assert.Len(t, entries, 1)
+	assert.Equal(t, map[string]string{"suite": "checkout"}, entries[0].Labels)
+
+	recorder = handleRequest(t, HandlerRemoveExpectations, "POST", "/gozzmock/remove_expectations", `{"labels": "suite in (a)"}`, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+
+	recorder = handleRequest(t, HandlerRemoveExpectations, "POST", "/gozzmock/remove_expectations", `{"labels": "suite"}`, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `["a","b"]`, recorder.Body.String())
+
+	recorder = handleRequest(t, HandlerVerify, "POST", "/gozzmock/verify", `{"labels": "=a"}`, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+}
+
+func TestHandlerNamespaces_IsolatedExpectationsAndJournal(t *testing.T) {
+	JournalReset()
+	defer JournalReset()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(namespacesPath, HandlerNamespaces)
+	mux.HandleFunc(namespacesPath+"/", HandlerNamespaces)
+	mux.HandleFunc("/gozzmock/add_expectation", HandlerAddExpectation)
+	mux.HandleFunc("/gozzmock/requests", HandlerGetRequests)
+	mux.HandleFunc("/", HandlerDefault)
+	handler := NamespaceHandler(mux)
+	suite1 := map[string]string{namespaceHeader: "suite1"}
+
+	recorder := handleRequest(t, handler.ServeHTTP, "POST", "/gozzmock/add_expectation", `{"key":"ns_user","response":{"httpcode":200,"body":"suite1"}}`, suite1)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = handleRequest(t, handler.ServeHTTP, "POST", "/gozzmock/namespaces", `{"name":"suite1"}`, nil)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	defer NamespaceDelete("suite1")
+	recorder = handleRequest(t, handler.ServeHTTP, "POST", "/gozzmock/namespaces", `{"name":"suite1"}`, nil)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	recorder = handleRequest(t, handler.ServeHTTP, "POST", "/gozzmock/namespaces", `{"name":"suite 2"}`, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+
+	recorder = handleRequest(t, handler.ServeHTTP, "GET", "/gozzmock/namespaces", "", nil)
+	assert.JSONEq(t, `["suite1"]`, recorder.Body.String())
+
+	recorder = handleRequest(t, handler.ServeHTTP, "POST", "/gozzmock/add_expectation", `{"key":"ns_user","request":{"path":"/ns_user"},"response":{"httpcode":200,"body":"suite1"}}`, suite1)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotContains(t, ControllerGetExpectations(nil), "ns_user")
+
+	// default namespace doesn't see expectation of suite1
+	recorder = handleRequest(t, handler.ServeHTTP, "GET", "/ns_user", "", nil)
+	assert.Equal(t, http.StatusNotImplemented, recorder.Code)
+
+	recorder = handleRequest(t, handler.ServeHTTP, "GET", "/ns_user", "", suite1)
+	assert.Equal(t, "suite1", recorder.Body.String())
+	recorder = handleRequest(t, handler.ServeHTTP, "GET", "/_ns/suite1/ns_user", "", nil)
+	assert.Equal(t, "suite1", recorder.Body.String())
+
+	recorder = handleRequest(t, handler.ServeHTTP, "GET", "/_ns/suite1/gozzmock/requests", "", nil)
+	entries := []JournalEntry{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &entries))
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "suite1", entries[0].Namespace)
+	assert.Equal(t, "ns_user", entries[0].Key)
+
+	recorder = handleRequest(t, handler.ServeHTTP, "GET", "/gozzmock/requests?path=ns_user", "", nil)
+	entries = []JournalEntry{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &entries))
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "", entries[0].Key)
+
+	recorder = handleRequest(t, handler.ServeHTTP, "DELETE", "/gozzmock/namespaces/suite1", "", nil)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	recorder = handleRequest(t, handler.ServeHTTP, "DELETE", "/gozzmock/namespaces/suite1", "", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	recorder = handleRequest(t, handler.ServeHTTP, "GET", "/_ns/suite1/ns_user", "", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestHandlerSnapshot_ExportAndImport(t *testing.T) {
+	snapshotTestCleanup()
+	defer snapshotTestCleanup()
+	snapshotTestState(t)
+
+	httpTestResponseRecorder := httptest.NewRecorder()
+	HandlerSnapshot(httpTestResponseRecorder, httptest.NewRequest("GET", "/gozzmock/snapshot", nil))
+	assert.Equal(t, http.StatusOK, httpTestResponseRecorder.Code)
+	body := httpTestResponseRecorder.Body.String()
+
+	snapshotTestCleanup()
+	httpTestResponseRecorder = httptest.NewRecorder()
+	HandlerSnapshot(httpTestResponseRecorder, httptest.NewRequest("POST", "/gozzmock/snapshot", bytes.NewBufferString(body)))
+	assert.Equal(t, http.StatusOK, httpTestResponseRecorder.Code)
+	assert.Equal(t, []string{"suite1"}, NamespaceList())
+	_, ok := ControllerGetExpectation("default", nil)
+	assert.True(t, ok)
+
+	httpTestResponseRecorder = httptest.NewRecorder()
+	HandlerSnapshot(httpTestResponseRecorder, httptest.NewRequest("POST", "/gozzmock/snapshot", bytes.NewBufferString(`{"version":1,"expectations":[{"key":"a"}]}`)))
+	assert.Equal(t, http.StatusUnprocessableEntity, httpTestResponseRecorder.Code)
+	_, ok = ControllerGetExpectation("default", nil)
+	assert.True(t, ok)
+
+	httpTestResponseRecorder = httptest.NewRecorder()
+	HandlerSnapshot(httpTestResponseRecorder, httptest.NewRequest("DELETE", "/gozzmock/snapshot", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, httpTestResponseRecorder.Code)
+}
+
+func TestHandlerAddExpectation_StoreFails_InternalServerError(t *testing.T) {
+	previous := ControllerGetStore(nil)
+	defer ControllerSetStore(previous)
+	ControllerSetStore(failingStore{NewMemoryStore()})
+
+	httpTestResponseRecorder := httptest.NewRecorder()
+	HandlerAddExpectation(httpTestResponseRecorder, httptest.NewRequest("POST", "/gozzmock/add_expectation", bytes.NewBufferString(`{"key":"k","response":{"httpcode":200}}`)))
+	assert.Equal(t, http.StatusInternalServerError, httpTestResponseRecorder.Code)
+	assert.Contains(t, httpTestResponseRecorder.Body.String(), "disk is full")
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// harVersion is version of HTTP Archive format
+const harVersion = "1.2"
+
+// harSkippedResponseHeaders aren't converted to expectation, HAR content is already decoded
+var harSkippedResponseHeaders = []string{"Content-Encoding", "Content-Length", "Transfer-Encoding", "Connection", "Keep-Alive"}
+
+// HAR is HTTP Archive
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is root of HTTP Archive
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator is application which created HTTP Archive
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is single request with response
+type HAREntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+}
+
+// HARNameValue is header, cookie or query parameter
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData is request body
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// HARRequest is request of HAR entry
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARContent is response body
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// HARResponse is response of HAR entry
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARTimings are durations of request phases in milliseconds
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// HARImportOptions control conversion of HAR entries to expectations
+type HARImportOptions struct {
+	KeyPrefix string
+	Priority  int
+	MatchURL  bool
+}
+
+func harNameValues(headers *Headers) []HARNameValue {
+	values := []HARNameValue{}
+	if headers == nil {
+		return values
+	}
+	for name, value := range *headers {
+		values = append(values, HARNameValue{Name: name, Value: value})
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Name < values[j].Name })
+	return values
+}
+
+func harHeader(headers *Headers, name string) string {
+	if headers == nil {
+		return ""
+	}
+	return (*headers)[name]
+}
+
+// HARFromJournal converts journal entries to HTTP Archive
+func HARFromJournal(entries []JournalEntry) HAR {
+	har := HAR{Log: HARLog{
+		Version: harVersion,
+		Creator: HARCreator{Name: "gozzmock", Version: version},
+		Entries: []HAREntry{}}}
+
+	for _, entry := range entries {
+		queryString := []HARNameValue{}
+		if requestURL, err := url.Parse(entry.Request.URL); err == nil {
+			for name, values := range requestURL.Query() {
+				for _, value := range values {
+					queryString = append(queryString, HARNameValue{Name: name, Value: value})
+				}
+			}
+		}
+		sort.Slice(queryString, func(i, j int) bool { return queryString[i].Name < queryString[j].Name })
+
+		request := HARRequest{
+			Method:      entry.Request.Method,
+			URL:         entry.Request.URL,
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []HARNameValue{},
+			Headers:     harNameValues(entry.Request.Headers),
+			QueryString: queryString,
+			HeadersSize: -1,
+			BodySize:    len(entry.Request.Body)}
+		if len(entry.Request.Body) > 0 {
+			request.PostData = &HARPostData{
+				MimeType: harHeader(entry.Request.Headers, "Content-Type"),
+				Text:     entry.Request.Body}
+		}
+
+		body := harDecodedBody(entry.Response)
+		content := HARContent{
+			Size:     len(body),
+			MimeType: harHeader(entry.Response.Headers, "Content-Type"),
+			Text:     body}
+		if !utf8.ValidString(body) {
+			content.Text = base64.StdEncoding.EncodeToString([]byte(body))
+			content.Encoding = "base64"
+		}
+
+		milliseconds := float64(entry.Duration) / float64(time.Millisecond)
+		har.Log.Entries = append(har.Log.Entries, HAREntry{
+			StartedDateTime: entry.Time.Format(time.RFC3339Nano),
+			Time:            milliseconds,
+			Request:         request,
+			Response: HARResponse{
+				Status:      entry.Response.HTTPCode,
+				StatusText:  http.StatusText(entry.Response.HTTPCode),
+				HTTPVersion: "HTTP/1.1",
+				Cookies:     []HARNameValue{},
+				Headers:     harNameValues(entry.Response.Headers),
+				Content:     content,
+				RedirectURL: harHeader(entry.Response.Headers, "Location"),
+				HeadersSize: -1,
+				BodySize:    len(entry.Response.Body)},
+			Timings: HARTimings{Wait: milliseconds}})
+	}
+	return har
+}
+
+// harDecodedBody returns response body decoded according to Content-Encoding, because HAR content keeps decoded body.
+// Body with unsupported encoding is returned as is
+func harDecodedBody(resp JournalResponse) string {
+	encoding := harHeader(resp.Headers, "Content-Encoding")
+	if encoding == "" {
+		return resp.Body
+	}
+	reader, err := decodeContentEncoding(encoding, []byte(resp.Body))
+	if reader == nil || err != nil {
+		return resp.Body
+	}
+	decoded, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return resp.Body
+	}
+	return string(decoded)
+}
+
+// HARToExpectations converts HAR entries to response expectations. Entries with the same method and URL
+// are converted once, the first entry is used. Entries without response are skipped.
+// Converted expectations are validated like uploaded ones. Returned error is *APIError
+func HARToExpectations(har HAR, options HARImportOptions) ([]Expectation, error) {
+	if options.KeyPrefix == "" {
+		options.KeyPrefix = "har"
+	}
+
+	exps := []Expectation{}
+	converted := map[string]bool{}
+	for i, entry := range har.Log.Entries {
+		if entry.Response.Status == 0 {
+			continue
+		}
+		requestKey := entry.Request.Method + " " + entry.Request.URL
+		if converted[requestKey] {
+			continue
+		}
+		converted[requestKey] = true
+
+		requestURL, err := url.Parse(entry.Request.URL)
+		if err != nil {
+			return nil, APIUnprocessable(fmt.Sprintf("entry %d has wrong url %s: %s", i, entry.Request.URL, err))
+		}
+
+		request := &ExpectationRequest{Method: entry.Request.Method}
+		if options.MatchURL {
+			request.URL = "^" + regexp.QuoteMeta(entry.Request.URL) + "$"
+		} else {
+			request.Path = "^" + regexp.QuoteMeta(requestURL.RequestURI()) + "$"
+		}
+
+		body := entry.Response.Content.Text
+		if entry.Response.Content.Encoding == "base64" {
+			decoded, err := base64.StdEncoding.DecodeString(body)
+			if err != nil {
+				return nil, APIUnprocessable(fmt.Sprintf("entry %d has wrong base64 content: %s", i, err))
+			}
+			body = string(decoded)
+		}
+
+		headers := Headers{}
+		for _, header := range entry.Response.Headers {
+			name := http.CanonicalHeaderKey(header.Name)
+			if strings.HasPrefix(header.Name, ":") || harSkippedHeader(name) {
+				continue
+			}
+			if value, ok := headers[name]; ok {
+				headers[name] = value + "," + header.Value
+				continue
+			}
+			headers[name] = header.Value
+		}
+
+		exp := Expectation{
+			Key:      fmt.Sprintf("%s_%d", options.KeyPrefix, len(exps)),
+			Request:  request,
+			Response: &ExpectationResponse{HTTPCode: entry.Response.Status, Body: body},
+			Priority: options.Priority}
+		if len(headers) > 0 {
+			exp.Response.Headers = &headers
+		}
+		exps = append(exps, exp)
+	}
+
+	fields := []APIFieldError{}
+	for i := range exps {
+		for _, field := range ExpectationValidate(exps[i]) {
+			field.Field = fmt.Sprintf("[%d].%s", i, field.Field)
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) > 0 {
+		return nil, APIUnprocessable("expectations are invalid", fields...)
+	}
+	return exps, nil
+}
+
+func harSkippedHeader(name string) bool {
+	for _, skipped := range harSkippedResponseHeaders {
+		if skipped == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHARFromJournal_Entry_Converted(t *testing.T) {
+	start := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	har := HARFromJournal([]JournalEntry{{
+		Time:     start,
+		Duration: 1500 * time.Microsecond,
+		Request: ExpectationRequest{
+			Method:  "POST",
+			URL:     "http://host/a?x=1&y=2",
+			Path:    "/a?x=1&y=2",
+			Body:    "{}",
+			Headers: &Headers{"Content-Type": "application/json"}},
+		Response: JournalResponse{
+			HTTPCode: http.StatusCreated,
+			Body:     "created",
+			Headers:  &Headers{"Content-Type": "text/plain"}}}})
+
+	assert.Equal(t, "1.2", har.Log.Version)
+	assert.Len(t, har.Log.Entries, 1)
+	entry := har.Log.Entries[0]
+	assert.Equal(t, "2018-01-02T03:04:05Z", entry.StartedDateTime)
+	assert.Equal(t, 1.5, entry.Time)
+	assert.Equal(t, "http://host/a?x=1&y=2", entry.Request.URL)
+	assert.Equal(t, []HARNameValue{{Name: "x", Value: "1"}, {Name: "y", Value: "2"}}, entry.Request.QueryString)
+	assert.Equal(t, &HARPostData{MimeType: "application/json", Text: "{}"}, entry.Request.PostData)
+	assert.Equal(t, http.StatusCreated, entry.Response.Status)
+	assert.Equal(t, "Created", entry.Response.StatusText)
+	assert.Equal(t, HARContent{Size: 7, MimeType: "text/plain", Text: "created"}, entry.Response.Content)
+}
+
+func TestHARFromJournal_BinaryBody_Base64(t *testing.T) {
+	har := HARFromJournal([]JournalEntry{{Response: JournalResponse{HTTPCode: http.StatusOK, Body: "\xff\xfe"}}})
+	assert.Equal(t, "base64", har.Log.Entries[0].Response.Content.Encoding)
+	assert.Equal(t, "//4=", har.Log.Entries[0].Response.Content.Text)
+}
+
+func TestHARFromJournal_GzipBody_Decoded(t *testing.T) {
+	var body bytes.Buffer
+	writer := gzip.NewWriter(&body)
+	writer.Write([]byte("hello"))
+	writer.Close()
+
+	har := HARFromJournal([]JournalEntry{{Response: JournalResponse{
+		HTTPCode: http.StatusOK,
+		Body:     body.String(),
+		Headers:  &Headers{"Content-Encoding": "gzip", "Content-Type": "text/plain"}}}})
+	assert.Equal(t, version, har.Log.Creator.Version)
+	assert.Equal(t, HARContent{Size: 5, MimeType: "text/plain", Text: "hello"}, har.Log.Entries[0].Response.Content)
+}
+
+func TestHARToExpectations_Entries_Converted(t *testing.T) {
+	har := HAR{Log: HARLog{Entries: []HAREntry{
+		{
+			Request: HARRequest{Method: "GET", URL: "https://api.host.com/users?page=1"},
+			Response: HARResponse{Status: http.StatusOK,
+				Headers: []HARNameValue{{Name: "content-type", Value: "application/json"}, {Name: "Content-Encoding", Value: "gzip"}, {Name: ":status", Value: "200"}},
+				Content: HARContent{Text: `[{"id":1}]`}}},
+		{
+			Request:  HARRequest{Method: "GET", URL: "https://api.host.com/users?page=1"},
+			Response: HARResponse{Status: http.StatusInternalServerError}},
+		{
+			Request:  HARRequest{Method: "GET", URL: "https://api.host.com/logo.png"},
+			Response: HARResponse{Status: http.StatusOK, Content: HARContent{Text: "//4=", Encoding: "base64"}}},
+		{
+			Request:  HARRequest{Method: "GET", URL: "https://api.host.com/blocked"},
+			Response: HARResponse{Status: 0}},
+	}}}
+
+	exps, err := HARToExpectations(har, HARImportOptions{Priority: 3})
+	assert.NoError(t, err)
+	assert.Len(t, exps, 2)
+
+	assert.Equal(t, "har_0", exps[0].Key)
+	assert.Equal(t, 3, exps[0].Priority)
+	assert.Equal(t, "GET", exps[0].Request.Method)
+	assert.Equal(t, `^/users\?page=1$`, exps[0].Request.Path)
+	assert.Equal(t, http.StatusOK, exps[0].Response.HTTPCode)
+	assert.Equal(t, `[{"id":1}]`, exps[0].Response.Body)
+	assert.Equal(t, &Headers{"Content-Type": "application/json"}, exps[0].Response.Headers)
+
+	assert.Equal(t, "har_1", exps[1].Key)
+	assert.Equal(t, "\xff\xfe", exps[1].Response.Body)
+	assert.Nil(t, exps[1].Response.Headers)
+
+	assert.True(t, ControllerRequestPassesFilter(&ExpectationRequest{Method: "GET", Path: "/users?page=1"}, exps[0].Request))
+	assert.False(t, ControllerRequestPassesFilter(&ExpectationRequest{Method: "GET", Path: "/users?page=10"}, exps[0].Request))
+}
+
+func TestHARToExpectations_MatchURL_URLFilter(t *testing.T) {
+	har := HAR{Log: HARLog{Entries: []HAREntry{{
+		Request:  HARRequest{Method: "GET", URL: "https://api.host.com/users"},
+		Response: HARResponse{Status: http.StatusOK}}}}}
+
+	exps, err := HARToExpectations(har, HARImportOptions{KeyPrefix: "qa", MatchURL: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "qa_0", exps[0].Key)
+	assert.Equal(t, `^https://api\.host\.com/users$`, exps[0].Request.URL)
+	assert.Empty(t, exps[0].Request.Path)
+}
+
+func TestHARToExpectations_WrongBase64_Error(t *testing.T) {
+	har := HAR{Log: HARLog{Entries: []HAREntry{{
+		Request:  HARRequest{Method: "GET", URL: "https://api.host.com/"},
+		Response: HARResponse{Status: http.StatusOK, Content: HARContent{Text: "!", Encoding: "base64"}}}}}}
+
+	_, err := HARToExpectations(har, HARImportOptions{})
+	assert.Error(t, err)
+}
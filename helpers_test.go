@@ -0,0 +1,15 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+// testTempDir creates temporary directory for test, caller removes it
+func testTempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "gozzmock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// journalDefaultSize is max number of requests in journal, the oldest requests are dropped
+const journalDefaultSize = 1000
+
+// JournalResponse is response returned by gozzmock
+type JournalResponse struct {
+	HTTPCode int      `json:"httpcode"`
+	Body     string   `json:"body"`
+	Headers  *Headers `json:"headers,omitempty"`
+}
+
+// JournalEntry is request received by gozzmock, key of applied expectation and returned response
+type JournalEntry struct {
+	ID        int64              `json:"id"`
+	Time      time.Time          `json:"time"`
+	Duration  time.Duration      `json:"duration"`
+	Namespace string             `json:"namespace,omitempty"`
+	Key       string             `json:"key,omitempty"`
+	Labels    map[string]string  `json:"labels,omitempty"`
+	Request   ExpectationRequest `json:"request"`
+	Response  JournalResponse    `json:"response"`
+}
+
+// JournalFilter selects journal entries of namespace
+type JournalFilter struct {
+	Namespace string
+	ID        int64
+	Request   *ExpectationRequest
+	Key       string
+	Unmatched bool
+	Labels    LabelSelector
+	Limit     int
+}
+
+// journals are journal entries by namespace, every namespace keeps up to journalSize entries
+var journals = map[string][]JournalEntry{}
+
+var journalSize = journalDefaultSize
+
+var journalLastID int64
+
+var journalMu sync.Mutex
+
+// JournalSetSize sets max number of requests in journal
+func JournalSetSize(size int) {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+
+	journalSize = size
+	for namespace := range journals {
+		journalTrim(namespace)
+	}
+}
+
+func journalTrim(namespace string) {
+	journal := journals[namespace]
+	if len(journal) > journalSize {
+		journals[namespace] = append([]JournalEntry{}, journal[len(journal)-journalSize:]...)
+	}
+}
+
+// JournalAdd adds request, key and labels of applied expectation and response to journal of request namespace.
+// Returns added entry
+func JournalAdd(start time.Time, req *ExpectationRequest, key string, labels map[string]string, resp JournalResponse) JournalEntry {
+	journalMu.Lock()
+	journalLastID++
+	entry := JournalEntry{
+		ID:        journalLastID,
+		Time:      start,
+		Duration:  time.Since(start),
+		Namespace: req.namespace,
+		Key:       key,
+		Labels:    labels,
+		Request:   *req,
+		Response:  resp}
+	if journalSize > 0 {
+		journals[req.namespace] = append(journals[req.namespace], entry)
+		journalTrim(req.namespace)
+	}
+	journalMu.Unlock()
+
+	// file is written without journal lock, so requests don't wait for each other's disk writes
+	if sink := JournalSinkGet(); sink != nil {
+		if err := sink.Write(entry); err != nil {
+			log.Error().Str("function", "JournalAdd").Err(err).Msg("Can't write request to journal file")
+		}
+	}
+	return entry
+}
+
+// JournalGet returns journal entries which pass filter, in order they were received.
+// If limit is set, only the latest entries are returned
+func JournalGet(filter JournalFilter) []JournalEntry {
+	journalMu.Lock()
+	entries := make([]JournalEntry, len(journals[filter.Namespace]))
+	copy(entries, journals[filter.Namespace])
+	journalMu.Unlock()
+
+	result := []JournalEntry{}
+	for _, entry := range entries {
+		if filter.ID != 0 && filter.ID != entry.ID {
+			continue
+		}
+		if filter.Unmatched && entry.Key != "" {
+			continue
+		}
+		if filter.Key != "" && filter.Key != entry.Key {
+			continue
+		}
+		if !filter.Labels.Matches(entry.Labels) {
+			continue
+		}
+		if filter.Request != nil && !ControllerRequestPassesFilter(&entry.Request, filter.Request) {
+			continue
+		}
+		result = append(result, entry)
+	}
+
+	if filter.Limit > 0 && len(result) > filter.Limit {
+		result = result[len(result)-filter.Limit:]
+	}
+	return result
+}
+
+// JournalFilterFromQuery parses filter from query parameters: method, host, path, body, key, unmatched, labels, limit
+func JournalFilterFromQuery(query url.Values) (JournalFilter, error) {
+	filter := JournalFilter{
+		Request: &ExpectationRequest{
+			Method: query.Get("method"),
+			Host:   query.Get("host"),
+			Path:   query.Get("path"),
+			Body:   query.Get("body")},
+		Key:       query.Get("key"),
+		Unmatched: query.Get("unmatched") == "true"}
+	if limit := query.Get("limit"); limit != "" {
+		var err error
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			return filter, APIBadRequest("invalid query", APIFieldError{Field: "limit", Message: "limit should be a number"})
+		}
+	}
+	var err error
+	filter.Labels, err = ParseLabelSelector(query.Get("labels"))
+	if err != nil {
+		return filter, APIBadRequest("invalid query", APIFieldError{Field: "labels", Message: err.Error()})
+	}
+	return filter, nil
+}
+
+// JournalReset removes all entries from journals of all namespaces
+func JournalReset() {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+
+	journals = map[string][]JournalEntry{}
+}
+
+// JournalResetNamespace removes all entries from journal of namespace
+func JournalResetNamespace(namespace string) {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+
+	delete(journals, namespace)
+}
+
+// JournalExport returns entries of all namespaces ordered by ID and the last used ID
+func JournalExport() ([]JournalEntry, int64) {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+
+	entries := []JournalEntry{}
+	for _, journal := range journals {
+		entries = append(entries, journal...)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries, journalLastID
+}
+
+// JournalRestore replaces journals of all namespaces with entries. IDs continue from lastID or the greatest entry ID
+func JournalRestore(entries []JournalEntry, lastID int64) {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+
+	journals = map[string][]JournalEntry{}
+	for _, entry := range entries {
+		entry.Request.namespace = entry.Namespace
+		journals[entry.Namespace] = append(journals[entry.Namespace], entry)
+		if entry.ID > lastID {
+			lastID = entry.ID
+		}
+	}
+	for namespace := range journals {
+		journalTrim(namespace)
+	}
+	journalLastID = lastID
+}
+
+// journalResponseWriter records response which is written to client
+type journalResponseWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *journalResponseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.statusCode = statusCode
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *journalResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Hijack is used by CONNECT tunnels, tunnel is established with status 200
+func (w *journalResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection can't be hijacked")
+	}
+	w.statusCode = http.StatusOK
+	w.wroteHeader = true
+	return hijacker.Hijack()
+}
+
+func (w *journalResponseWriter) response() JournalResponse {
+	statusCode := w.statusCode
+	if !w.wroteHeader {
+		statusCode = http.StatusOK
+	}
+	return JournalResponse{
+		HTTPCode: statusCode,
+		Body:     w.body.String(),
+		Headers:  ControllerTranslateHTTPHeadersToExpHeaders(w.Header())}
+}
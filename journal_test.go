@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalAdd_SizeReached_OldestDropped(t *testing.T) {
+	JournalReset()
+	JournalSetSize(2)
+	defer JournalSetSize(journalDefaultSize)
+	defer JournalReset()
+
+	for _, path := range []string{"/1", "/2", "/3"} {
+		JournalAdd(time.Now(), &ExpectationRequest{Path: path}, "", nil, JournalResponse{})
+	}
+
+	entries := JournalGet(JournalFilter{})
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "/2", entries[0].Request.Path)
+	assert.Equal(t, "/3", entries[1].Request.Path)
+	assert.True(t, entries[0].ID < entries[1].ID)
+}
+
+func TestJournalGet_Filters(t *testing.T) {
+	JournalReset()
+	defer JournalReset()
+
+	JournalAdd(time.Now(), &ExpectationRequest{Method: "GET", Path: "/a"}, "k1", nil, JournalResponse{HTTPCode: http.StatusOK})
+	JournalAdd(time.Now(), &ExpectationRequest{Method: "POST", Path: "/b", Body: "data"}, "k2", nil, JournalResponse{HTTPCode: http.StatusOK})
+	JournalAdd(time.Now(), &ExpectationRequest{Method: "GET", Path: "/c"}, "", nil, JournalResponse{HTTPCode: http.StatusNotImplemented})
+
+	assert.Len(t, JournalGet(JournalFilter{}), 3)
+	assert.Len(t, JournalGet(JournalFilter{Request: &ExpectationRequest{Method: "GET"}}), 2)
+	assert.Len(t, JournalGet(JournalFilter{Request: &ExpectationRequest{Body: "dat"}}), 1)
+	assert.Len(t, JournalGet(JournalFilter{Key: "k1"}), 1)
+
+	unmatched := JournalGet(JournalFilter{Unmatched: true})
+	assert.Len(t, unmatched, 1)
+	assert.Equal(t, "/c", unmatched[0].Request.Path)
+
+	latest := JournalGet(JournalFilter{Limit: 1})
+	assert.Len(t, latest, 1)
+	assert.Equal(t, "/c", latest[0].Request.Path)
+}
+
+func TestJournalResponseWriter_RecordsResponse(t *testing.T) {
+	recorder := &journalResponseWriter{ResponseWriter: httptest.NewRecorder()}
+	recorder.Header().Set("X-A", "1")
+	recorder.WriteHeader(http.StatusCreated)
+	recorder.WriteHeader(http.StatusOK)
+	recorder.Write([]byte("body"))
+
+	resp := recorder.response()
+	assert.Equal(t, http.StatusCreated, resp.HTTPCode)
+	assert.Equal(t, "body", resp.Body)
+	assert.Equal(t, "1", (*resp.Headers)["X-A"])
+}
+
+func TestJournalResponseWriter_NoWriteHeader_StatusOK(t *testing.T) {
+	recorder := &journalResponseWriter{ResponseWriter: httptest.NewRecorder()}
+	assert.Equal(t, http.StatusOK, recorder.response().HTTPCode)
+	recorder.Write([]byte("body"))
+	assert.Equal(t, http.StatusOK, recorder.response().HTTPCode)
+}
+
+func TestJournalAdd_MatchedExpectation_LabelsRecorded(t *testing.T) {
+	JournalReset()
+	defer JournalReset()
+
+	entry := JournalAdd(time.Now(), &ExpectationRequest{Path: "/a"}, "journal_labels", map[string]string{"suite": "checkout"}, JournalResponse{})
+	assert.Equal(t, map[string]string{"suite": "checkout"}, entry.Labels)
+	JournalAdd(time.Now(), &ExpectationRequest{Path: "/b"}, "", nil, JournalResponse{})
+
+	selector, err := ParseLabelSelector("suite=checkout")
+	assert.NoError(t, err)
+	entries := JournalGet(JournalFilter{Labels: selector})
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "/a", entries[0].Request.Path)
+
+	filter, err := JournalFilterFromQuery(url.Values{"labels": {"!suite"}})
+	assert.NoError(t, err)
+	entries = JournalGet(filter)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "/b", entries[0].Request.Path)
+
+	_, err = JournalFilterFromQuery(url.Values{"labels": {"=a"}})
+	assert.Error(t, err)
+}
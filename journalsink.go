@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+const (
+	journalSinkDefaultMaxSize  = 10 * 1024 * 1024
+	journalSinkDefaultMaxFiles = 5
+)
+
+// JournalSink appends journal entries to file as JSON Lines. File is rotated when it exceeds max size:
+// file.jsonl is renamed to file.jsonl.1, file.jsonl.1 to file.jsonl.2 and so on, the oldest files are removed
+type JournalSink struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+}
+
+var journalSink *JournalSink
+
+var journalSinkMu sync.Mutex
+
+// JournalSinkOpen opens file for appending. maxSize is max size of file in bytes, maxFiles is number of kept rotated files
+func JournalSinkOpen(path string, maxSize int64, maxFiles int) (*JournalSink, error) {
+	if maxSize <= 0 {
+		maxSize = journalSinkDefaultMaxSize
+	}
+	if maxFiles < 0 {
+		maxFiles = 0
+	}
+	s := &JournalSink{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *JournalSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// rotate closes file, shifts rotated files and opens new file. Current file is reopened even if shift fails,
+// so next entries are still written
+func (s *JournalSink) rotate() error {
+	err := s.file.Close()
+	if err == nil {
+		err = s.shift()
+	}
+	if openErr := s.open(); openErr != nil {
+		s.file = nil
+		if err == nil {
+			return openErr
+		}
+		return fmt.Errorf("%s, journal file can't be reopened: %s", err, openErr)
+	}
+	return err
+}
+
+// shift removes the oldest rotated file and renames the others
+func (s *JournalSink) shift() error {
+	if s.maxFiles == 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxFiles))
+	for i := s.maxFiles - 1; i >= 1; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(s.path, s.path+".1")
+}
+
+// Write appends entry as single JSON line
+func (s *JournalSink) Write(entry JournalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return fmt.Errorf("journal file %s is closed", s.path)
+	}
+	var rotateErr error
+	if s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		// if rotation fails, entry is appended to current file
+		if rotateErr = s.rotate(); s.file == nil {
+			return rotateErr
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if rotateErr != nil {
+		return rotateErr
+	}
+	return err
+}
+
+// Close closes file
+func (s *JournalSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// JournalSinkSet sets sink which receives every journal entry. nil disables sink
+func JournalSinkSet(s *JournalSink) {
+	journalSinkMu.Lock()
+	defer journalSinkMu.Unlock()
+
+	journalSink = s
+}
+
+// JournalSinkGet returns sink which receives journal entries or nil if sink is disabled
+func JournalSinkGet() *JournalSink {
+	journalSinkMu.Lock()
+	defer journalSinkMu.Unlock()
+
+	return journalSink
+}
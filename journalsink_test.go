@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readJournalLines(t *testing.T, path string) []JournalEntry {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	entries := []JournalEntry{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := JournalEntry{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestJournalSink_Write_JSONLines(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal.jsonl")
+
+	sink, err := JournalSinkOpen(path, 0, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Write(JournalEntry{ID: 1, Key: "k", Request: ExpectationRequest{Method: "GET", Path: "/a"}}))
+	assert.NoError(t, sink.Write(JournalEntry{ID: 2, Response: JournalResponse{HTTPCode: 501}}))
+	assert.NoError(t, sink.Close())
+
+	entries := readJournalLines(t, path)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "k", entries[0].Key)
+	assert.Equal(t, "/a", entries[0].Request.Path)
+	assert.Equal(t, 501, entries[1].Response.HTTPCode)
+}
+
+func TestJournalSink_ExistingFile_Appended(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal.jsonl")
+
+	for id := int64(1); id <= 2; id++ {
+		sink, err := JournalSinkOpen(path, 0, 0)
+		assert.NoError(t, err)
+		assert.NoError(t, sink.Write(JournalEntry{ID: id}))
+		assert.NoError(t, sink.Close())
+	}
+	assert.Len(t, readJournalLines(t, path), 2)
+}
+
+func TestJournalSink_SizeExceeded_Rotated(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal.jsonl")
+
+	line, _ := json.Marshal(JournalEntry{ID: 1})
+	sink, err := JournalSinkOpen(path, int64(len(line)+1), 2)
+	assert.NoError(t, err)
+	for id := int64(1); id <= 4; id++ {
+		assert.NoError(t, sink.Write(JournalEntry{ID: id}))
+	}
+	assert.NoError(t, sink.Close())
+
+	assert.Equal(t, int64(4), readJournalLines(t, path)[0].ID)
+	assert.Equal(t, int64(3), readJournalLines(t, path+".1")[0].ID)
+	assert.Equal(t, int64(2), readJournalLines(t, path+".2")[0].ID)
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestJournalSink_Closed_Error(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+
+	sink, err := JournalSinkOpen(filepath.Join(dir, "journal.jsonl"), 0, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Close())
+	assert.Error(t, sink.Write(JournalEntry{}))
+}
+
+func TestJournalAdd_SinkSet_EntryWritten(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal.jsonl")
+
+	sink, err := JournalSinkOpen(path, 0, 0)
+	assert.NoError(t, err)
+	JournalSinkSet(sink)
+	defer JournalSinkSet(nil)
+	defer JournalReset()
+
+	entry := JournalAdd(time.Now(), &ExpectationRequest{Method: "POST", Path: "/sink"}, "sink_key", nil, JournalResponse{HTTPCode: 200, Body: "ok"})
+	assert.NoError(t, sink.Close())
+
+	entries := readJournalLines(t, path)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, entry.ID, entries[0].ID)
+	assert.Equal(t, "sink_key", entries[0].Key)
+	assert.Equal(t, "/sink", entries[0].Request.Path)
+	assert.Equal(t, "ok", entries[0].Response.Body)
+}
+
+func TestJournalSink_RotationFails_FileReopened(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal.jsonl")
+	// rotated file can't replace non-empty directory
+	assert.NoError(t, os.MkdirAll(filepath.Join(path+".1", "busy"), 0755))
+
+	line, _ := json.Marshal(JournalEntry{ID: 1})
+	sink, err := JournalSinkOpen(path, int64(len(line)+1), 1)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Write(JournalEntry{ID: 1}))
+	assert.Error(t, sink.Write(JournalEntry{ID: 2}))
+
+	assert.NoError(t, os.RemoveAll(path+".1"))
+	assert.NoError(t, sink.Write(JournalEntry{ID: 3}))
+	assert.NoError(t, sink.Close())
+
+	assert.Equal(t, int64(3), readJournalLines(t, path)[0].ID)
+	assert.Len(t, readJournalLines(t, path+".1"), 2)
+}
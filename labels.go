@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Operators of label selector requirements
+const (
+	LabelEquals       = "="
+	LabelNotEquals    = "!="
+	LabelExists       = "exists"
+	LabelDoesNotExist = "!exists"
+)
+
+var (
+	labelNameRegexp  = regexp.MustCompile(`^[A-Za-z0-9._/-]+$`)
+	labelValueRegexp = regexp.MustCompile(`^[A-Za-z0-9._/-]*$`)
+)
+
+// LabelRequirement is single condition of label selector
+type LabelRequirement struct {
+	Key      string
+	Operator string
+	Value    string
+}
+
+// LabelSelector is list of requirements which all should be met. Empty selector matches all labels
+type LabelSelector []LabelRequirement
+
+// ParseLabelSelector parses comma separated requirements: "key=value", "key==value", "key!=value",
+// "key" - label exists, "!key" - label doesn't exist
+func ParseLabelSelector(str string) (LabelSelector, error) {
+	selector := LabelSelector{}
+	if strings.TrimSpace(str) == "" {
+		return selector, nil
+	}
+
+	for _, part := range strings.Split(str, ",") {
+		part = strings.TrimSpace(part)
+		requirement := LabelRequirement{}
+		switch {
+		case strings.Contains(part, "!="):
+			i := strings.Index(part, "!=")
+			requirement = LabelRequirement{Key: part[:i], Operator: LabelNotEquals, Value: part[i+2:]}
+		case strings.Contains(part, "=="):
+			i := strings.Index(part, "==")
+			requirement = LabelRequirement{Key: part[:i], Operator: LabelEquals, Value: part[i+2:]}
+		case strings.Contains(part, "="):
+			i := strings.Index(part, "=")
+			requirement = LabelRequirement{Key: part[:i], Operator: LabelEquals, Value: part[i+1:]}
+		case strings.HasPrefix(part, "!"):
+			requirement = LabelRequirement{Key: part[1:], Operator: LabelDoesNotExist}
+		default:
+			requirement = LabelRequirement{Key: part, Operator: LabelExists}
+		}
+		requirement.Key = strings.TrimSpace(requirement.Key)
+		requirement.Value = strings.TrimSpace(requirement.Value)
+		if requirement.Key == "" {
+			return nil, fmt.Errorf("label selector %s has requirement without label key", str)
+		}
+		if !labelNameRegexp.MatchString(requirement.Key) || !labelValueRegexp.MatchString(requirement.Value) {
+			return nil, fmt.Errorf("label selector %s has invalid requirement %s", str, part)
+		}
+		selector = append(selector, requirement)
+	}
+	return selector, nil
+}
+
+// Matches returns true if labels meet all requirements of selector
+func (selector LabelSelector) Matches(labels map[string]string) bool {
+	for _, requirement := range selector {
+		value, ok := labels[requirement.Key]
+		switch requirement.Operator {
+		case LabelEquals:
+			if !ok || value != requirement.Value {
+				return false
+			}
+		case LabelNotEquals:
+			if ok && value == requirement.Value {
+				return false
+			}
+		case LabelExists:
+			if !ok {
+				return false
+			}
+		case LabelDoesNotExist:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLabelSelector_AllOperators(t *testing.T) {
+	selector, err := ParseLabelSelector("suite=checkout, env==qa,team!=payments,owner,!temporary")
+	assert.NoError(t, err)
+	assert.Equal(t, LabelSelector{
+		{Key: "suite", Operator: LabelEquals, Value: "checkout"},
+		{Key: "env", Operator: LabelEquals, Value: "qa"},
+		{Key: "team", Operator: LabelNotEquals, Value: "payments"},
+		{Key: "owner", Operator: LabelExists},
+		{Key: "temporary", Operator: LabelDoesNotExist}}, selector)
+
+	selector, err = ParseLabelSelector(" ")
+	assert.NoError(t, err)
+	assert.Empty(t, selector)
+}
+
+func TestParseLabelSelector_Invalid_Error(t *testing.T) {
+	for _, str := range []string{"=a", "a,,b", "!", "a=b=c", "a!=b=c", "suite in (a)"} {
+		_, err := ParseLabelSelector(str)
+		assert.Error(t, err, str)
+	}
+}
+
+func TestLabelSelector_Matches(t *testing.T) {
+	labels := map[string]string{"suite": "checkout", "owner": "qa"}
+	for str, expected := range map[string]bool{
+		"":                        true,
+		"suite=checkout":          true,
+		"suite=checkout,owner":    true,
+		"suite=login":             false,
+		"suite!=login":            true,
+		"suite!=checkout":         false,
+		"env!=prod":               true,
+		"env":                     false,
+		"!env":                    true,
+		"!owner":                  false,
+		"suite=checkout,owner=pm": false,
+	} {
+		selector, err := ParseLabelSelector(str)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, selector.Matches(labels), str)
+	}
+	assert.False(t, LabelSelector{{Key: "suite", Operator: LabelEquals, Value: "checkout"}}.Matches(nil))
+}
@@ -1,15 +1,23 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
-
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
+// version of gozzmock, set at build time with -ldflags "-X main.version=1.2.3"
+var version = "dev"
+
 func httpHandleFuncWithLogs(pattern string, handler func(http.ResponseWriter, *http.Request)) {
 	wrappedHandler := func(w http.ResponseWriter, r *http.Request) {
 		LogRequest(r)
@@ -44,29 +52,184 @@ func setZeroLogLevel(logLevel string) {
 
 }
 
+// splitFlagList splits comma separated flag value, empty items are skipped
+func splitFlagList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// shutdownOnSignal waits for SIGINT or SIGTERM, saves server state to snapshot file if it's set,
+// closes expectations store and exits
+func shutdownOnSignal(snapshotFile string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+
+	code := 0
+	if snapshotFile != "" {
+		if err := SnapshotSave(snapshotFile); err != nil {
+			fmt.Fprintln(os.Stderr, "can't save snapshot:", err.Error())
+			code = 1
+		}
+	}
+	if err := ControllerGetStore(nil).Close(); err != nil {
+		fmt.Fprintln(os.Stderr, "can't close expectations store:", err.Error())
+		code = 1
+	}
+	os.Exit(code)
+}
+
 func main() {
 	var initExpectations string
 	flag.StringVar(&initExpectations, "expectations", "[]", "set initial expectations")
+	var expectationsFiles string
+	flag.StringVar(&expectationsFiles, "expectations-file", "", "load expectations from comma separated JSON files and reload them on change")
+	var expectationsDirs string
+	flag.StringVar(&expectationsDirs, "expectations-dir", "", "load expectations from *.json files of comma separated directories and reload them on change")
+	var expectationsPoll time.Duration
+	flag.DurationVar(&expectationsPoll, "expectations-poll", expectationFilesDefaultInterval, "set interval of checking expectation files for changes")
+	var storeDir string
+	flag.StringVar(&storeDir, "store", "", "keep expectations in directory, so they survive restarts, expectations are kept in memory if empty")
+	var initUnmatched string
+	flag.StringVar(&initUnmatched, "unmatched", "{\"action\":\"notimplemented\"}", "set behaviour for unmatched requests")
+	var mitmEnabled bool
+	flag.BoolVar(&mitmEnabled, "mitm", false, "intercept HTTPS traffic of CONNECT tunnels")
+	var caCert string
+	flag.StringVar(&caCert, "cacert", "", "CA certificate PEM file for HTTPS interception, generated if doesn't exist")
+	var caKey string
+	flag.StringVar(&caKey, "cakey", "", "CA private key PEM file for HTTPS interception, generated if doesn't exist")
+	var journalSize int
+	flag.IntVar(&journalSize, "journalsize", journalDefaultSize, "set max number of requests in journal")
+	var journalFile string
+	flag.StringVar(&journalFile, "journalfile", "", "append every request of journal to JSON Lines file, disabled if empty")
+	var journalFileSize int64
+	flag.Int64Var(&journalFileSize, "journalfilesize", journalSinkDefaultMaxSize, "set max size of journal file in bytes, file is rotated when size is exceeded")
+	var journalFiles int
+	flag.IntVar(&journalFiles, "journalfiles", journalSinkDefaultMaxFiles, "set number of kept rotated journal files")
+	var snapshotFile string
+	flag.StringVar(&snapshotFile, "snapshot", "", "restore server state from file at startup if it exists and save state to it on shutdown")
 	var logLevel string
 	flag.StringVar(&logLevel, "loglevel", "debug", "set log level: debug, info, warn, error, fatal, panic")
 	flag.Parse()
 
+	if journalSize < 0 {
+		fmt.Fprintln(os.Stderr, "journal size is invalid:", journalSize, "should be 0 or greater")
+		os.Exit(2)
+	}
+
 	fmt.Println("initial expectations:", initExpectations)
+	fmt.Println("unmatched:", initUnmatched)
 	fmt.Println("loglevel:", logLevel)
 	fmt.Println("tail:", flag.Args())
 
 	setZeroLogLevel(logLevel)
 
-	exps := ExpectationsFromString(initExpectations)
+	if storeDir != "" {
+		s, err := NewFileStore(storeDir, storeFileDefaultCompactRecords)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "can't open expectations store:", err.Error())
+			os.Exit(2)
+		}
+		ControllerSetStore(s)
+		fmt.Println("expectations loaded from store:", len(s.List()))
+	}
+
+	u := Unmatched{}
+	err := json.Unmarshal([]byte(initUnmatched), &u)
+	if err == nil {
+		err = UnmatchedSet(u)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "unmatched behaviour is invalid:", err.Error())
+		os.Exit(2)
+	}
+
+	JournalSetSize(journalSize)
+
+	if journalFile != "" {
+		sink, err := JournalSinkOpen(journalFile, journalFileSize, journalFiles)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "can't open journal file:", err.Error())
+			os.Exit(2)
+		}
+		defer sink.Close()
+		JournalSinkSet(sink)
+	}
+
+	// snapshot is restored before expectations of flags and files, so import doesn't remove them
+	if snapshotFile != "" {
+		if _, err := os.Stat(snapshotFile); err == nil {
+			if err := SnapshotLoad(snapshotFile); err != nil {
+				fmt.Fprintln(os.Stderr, "snapshot is invalid:", err.Error())
+				os.Exit(2)
+			}
+			fmt.Println("state restored from snapshot:", snapshotFile)
+		}
+	}
+
+	exps, err := ExpectationsFromString(initExpectations)
+	if err != nil {
+		errjson, _ := json.Marshal(err)
+		fmt.Fprintln(os.Stderr, "initial expectations are invalid:", string(errjson))
+		os.Exit(2)
+	}
+
+	if _, err = ControllerAddExpectations(exps, false, nil); err != nil {
+		fmt.Fprintln(os.Stderr, "can't add initial expectations:", err.Error())
+		os.Exit(2)
+	}
+
+	if expectationsFiles != "" || expectationsDirs != "" {
+		files := ExpectationFilesOpen(splitFlagList(expectationsFiles), splitFlagList(expectationsDirs), nil)
+		if _, err := files.Reload(); err != nil {
+			fmt.Fprintln(os.Stderr, "expectation files are invalid:", err.Error())
+			os.Exit(2)
+		}
+		fmt.Println("expectations loaded from files:", files.Loaded())
+		go files.Watch(expectationsPoll, nil)
+	}
+
+	go shutdownOnSignal(snapshotFile)
 
-	for _, exp := range exps {
-		ControllerAddExpectation(exp.Key, exp, nil)
+	if mitmEnabled {
+		m, err := MITMLoadOrCreateCA(caCert, caKey)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "can't load CA for HTTPS interception:", err.Error())
+			os.Exit(2)
+		}
+		MITMSet(m)
 	}
 
 	http.HandleFunc("/gozzmock/status", HandlerStatus)
+	http.HandleFunc("/gozzmock/ca.pem", HandlerCACertificate)
 	httpHandleFuncWithLogs("/gozzmock/add_expectation", HandlerAddExpectation)
 	httpHandleFuncWithLogs("/gozzmock/remove_expectation", HandlerRemoveExpectation)
 	httpHandleFuncWithLogs("/gozzmock/get_expectations", HandlerGetExpectations)
+	httpHandleFuncWithLogs(expectationsPath, HandlerExpectations)
+	httpHandleFuncWithLogs(expectationsPath+"/", HandlerExpectations)
+	httpHandleFuncWithLogs("/gozzmock/add_expectations", HandlerAddExpectations)
+	httpHandleFuncWithLogs(namespacesPath, HandlerNamespaces)
+	httpHandleFuncWithLogs(namespacesPath+"/", HandlerNamespaces)
+	httpHandleFuncWithLogs("/gozzmock/remove_expectations", HandlerRemoveExpectations)
+	httpHandleFuncWithLogs("/gozzmock/reset_expectations", HandlerResetExpectations)
+	httpHandleFuncWithLogs("/gozzmock/unmatched", HandlerUnmatched)
+	httpHandleFuncWithLogs("/gozzmock/requests", HandlerGetRequests)
+	httpHandleFuncWithLogs("/gozzmock/reset_requests", HandlerResetRequests)
+	httpHandleFuncWithLogs("/gozzmock/har", HandlerGetHAR)
+	httpHandleFuncWithLogs("/gozzmock/import_har", HandlerImportHAR)
+	httpHandleFuncWithLogs("/gozzmock/explain", HandlerExplain)
+	httpHandleFuncWithLogs("/gozzmock/verify", HandlerVerify)
+	httpHandleFuncWithLogs("/gozzmock/verify_sequence", HandlerVerifySequence)
+	httpHandleFuncWithLogs("/gozzmock/snapshot", HandlerSnapshot)
+	httpHandleFuncWithLogs("/gozzmock/get_cache", HandlerGetCache)
+	httpHandleFuncWithLogs("/gozzmock/purge_cache", HandlerPurgeCache)
+	httpHandleFuncWithLogs("/gozzmock/get_mirror_diffs", HandlerGetMirrorDiffs)
+	httpHandleFuncWithLogs("/gozzmock/reset_mirror_diffs", HandlerResetMirrorDiffs)
 	httpHandleFuncWithLogs("/", HandlerDefault)
-	http.ListenAndServe(":8080", nil)
+	http.ListenAndServe(":8080", ProxyHandler(NamespaceHandler(http.DefaultServeMux)))
 }
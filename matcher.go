@@ -0,0 +1,261 @@
+package main
+
+import (
+	"container/list"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// filterCacheSize is max number of recently used filters cached by CompileStringMatcher
+	filterCacheSize = 4096
+	// indexHostCacheSize is max number of method and host pairs which candidates are cached by index
+	indexHostCacheSize = 1024
+)
+
+// StringMatcher is compiled string filter. Filter is a regex, or substring if it isn't valid regex
+type StringMatcher struct {
+	filter  string
+	literal bool
+	re      *regexp.Regexp
+}
+
+// filterCache is LRU cache of compiled filters for filters which aren't kept by index, like journal and list filters
+type filterCache struct {
+	mu       sync.Mutex
+	matchers map[string]*list.Element
+	order    *list.List
+}
+
+var filters = &filterCache{matchers: map[string]*list.Element{}, order: list.New()}
+
+func (c *filterCache) get(filter string) (*StringMatcher, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.matchers[filter]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*StringMatcher), true
+}
+
+func (c *filterCache) put(m *StringMatcher) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.matchers[m.filter]; ok {
+		return
+	}
+	c.matchers[m.filter] = c.order.PushFront(m)
+	for c.order.Len() > filterCacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.matchers, oldest.Value.(*StringMatcher).filter)
+	}
+}
+
+// CompileStringMatcher compiles filter. Recently used filters are cached
+func CompileStringMatcher(filter string) *StringMatcher {
+	if m, ok := filters.get(filter); ok {
+		return m
+	}
+
+	// regex without special characters is matched as substring, which is faster
+	m := &StringMatcher{filter: filter, literal: true}
+	if regexp.QuoteMeta(filter) != filter {
+		if re, err := regexp.Compile("(?s)" + filter); err == nil {
+			m.literal = false
+			m.re = re
+		}
+	}
+	filters.put(m)
+	return m
+}
+
+// Matches returns true if str passes filter
+func (m *StringMatcher) Matches(str string) bool {
+	if m.literal {
+		return strings.Contains(str, m.filter)
+	}
+	return m.re.MatchString(str)
+}
+
+// headerMatcher is compiled filter of one header
+type headerMatcher struct {
+	name  string
+	value *StringMatcher
+}
+
+// RequestMatcher is compiled request filter of expectation. It gives the same result as ControllerRequestPassesFilter
+type RequestMatcher struct {
+	method  string
+	host    *StringMatcher
+	url     *StringMatcher
+	path    *StringMatcher
+	body    *StringMatcher
+	headers []headerMatcher
+}
+
+// compileOptional compiles filter, empty filter isn't checked
+func compileOptional(filter string) *StringMatcher {
+	if filter == "" {
+		return nil
+	}
+	return CompileStringMatcher(filter)
+}
+
+// CompileRequestMatcher compiles request filter. Nil filter passes all requests
+func CompileRequestMatcher(filter *ExpectationRequest) *RequestMatcher {
+	m := &RequestMatcher{}
+	if filter == nil {
+		return m
+	}
+	m.method = filter.Method
+	m.host = compileOptional(filter.Host)
+	m.url = compileOptional(filter.URL)
+	m.path = compileOptional(filter.Path)
+	m.body = compileOptional(filter.Body)
+	if filter.Headers != nil {
+		for name, value := range *filter.Headers {
+			m.headers = append(m.headers, headerMatcher{name: name, value: CompileStringMatcher(value)})
+		}
+		sort.Slice(m.headers, func(i, j int) bool { return m.headers[i].name < m.headers[j].name })
+	}
+	return m
+}
+
+// Matches returns true if request passes filter
+func (m *RequestMatcher) Matches(req *ExpectationRequest) bool {
+	return m.matchesMethodAndHost(req.Method, req.Host) && m.matchesRest(req)
+}
+
+func (m *RequestMatcher) matchesMethodAndHost(method string, host string) bool {
+	if m.method != "" && m.method != method {
+		return false
+	}
+	return m.host == nil || m.host.Matches(host)
+}
+
+func (m *RequestMatcher) matchesRest(req *ExpectationRequest) bool {
+	if m.url != nil && !m.url.Matches(req.URL) {
+		return false
+	}
+	if m.path != nil && !m.path.Matches(req.Path) {
+		return false
+	}
+	if m.body != nil && !m.body.Matches(req.Body) {
+		return false
+	}
+	for _, header := range m.headers {
+		if req.Headers == nil {
+			return false
+		}
+		value, ok := (*req.Headers)[header.name]
+		if !ok || !header.value.Matches(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// indexedExpectation is expectation with request filter compiled at insert time
+type indexedExpectation struct {
+	exp     Expectation
+	matcher *RequestMatcher
+}
+
+func newIndexedExpectation(exp Expectation) *indexedExpectation {
+	return &indexedExpectation{exp: exp, matcher: CompileRequestMatcher(exp.Request)}
+}
+
+// ExpectationIndex is immutable list of expectations ordered by priority DESC, then by key.
+// Expectations are pre-filtered by method and host of request, candidates of each method and host are cached
+type ExpectationIndex struct {
+	count      int
+	anyMethod  []*indexedExpectation
+	byMethod   map[string][]*indexedExpectation
+	hosts      sync.Map
+	hostsCount int32
+}
+
+// newExpectationIndex builds index of expectations
+func newExpectationIndex(entries map[string]*indexedExpectation) *ExpectationIndex {
+	ordered := make([]*indexedExpectation, 0, len(entries))
+	for _, entry := range entries {
+		ordered = append(ordered, entry)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].exp.Priority != ordered[j].exp.Priority {
+			return ordered[i].exp.Priority > ordered[j].exp.Priority
+		}
+		return ordered[i].exp.Key < ordered[j].exp.Key
+	})
+
+	idx := &ExpectationIndex{count: len(ordered), anyMethod: []*indexedExpectation{}, byMethod: map[string][]*indexedExpectation{}}
+	for _, entry := range ordered {
+		if entry.matcher.method == "" {
+			idx.anyMethod = append(idx.anyMethod, entry)
+		} else {
+			idx.byMethod[entry.matcher.method] = nil
+		}
+	}
+	// every method list keeps expectations of the method and expectations without method in priority order
+	for method := range idx.byMethod {
+		list := []*indexedExpectation{}
+		for _, entry := range ordered {
+			if entry.matcher.method == "" || entry.matcher.method == method {
+				list = append(list, entry)
+			}
+		}
+		idx.byMethod[method] = list
+	}
+	return idx
+}
+
+// candidates returns expectations which pass method and host filters, in priority order
+func (idx *ExpectationIndex) candidates(method string, host string) []*indexedExpectation {
+	cacheKey := method + " " + host
+	if cached, ok := idx.hosts.Load(cacheKey); ok {
+		return cached.([]*indexedExpectation)
+	}
+
+	list, ok := idx.byMethod[method]
+	if !ok {
+		list = idx.anyMethod
+	}
+	candidates := []*indexedExpectation{}
+	for _, entry := range list {
+		if entry.matcher.matchesMethodAndHost(method, host) {
+			candidates = append(candidates, entry)
+		}
+	}
+
+	// index is rebuilt on every change, so its cache is only limited, not evicted. Concurrent misses of the same key
+	// are counted once
+	if atomic.LoadInt32(&idx.hostsCount) < indexHostCacheSize {
+		if _, loaded := idx.hosts.LoadOrStore(cacheKey, candidates); !loaded {
+			atomic.AddInt32(&idx.hostsCount, 1)
+		}
+	}
+	return candidates
+}
+
+// Match returns expectation with the highest priority which request passes
+func (idx *ExpectationIndex) Match(req *ExpectationRequest) (Expectation, bool) {
+	for _, entry := range idx.candidates(req.Method, req.Host) {
+		if entry.matcher.matchesRest(req) {
+			return entry.exp, true
+		}
+	}
+	return Expectation{}, false
+}
+
+// Len returns number of expectations in index
+func (idx *ExpectationIndex) Len() int {
+	return idx.count
+}
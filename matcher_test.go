@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileStringMatcher_LiteralRegexAndInvalidRegex(t *testing.T) {
+	assert.True(t, CompileStringMatcher("github").Matches("api.github.com"))
+	assert.False(t, CompileStringMatcher("github").Matches("gitlab.com"))
+	assert.True(t, CompileStringMatcher("^/users/[0-9]+$").Matches("/users/42"))
+	assert.False(t, CompileStringMatcher("^/users/[0-9]+$").Matches("/users/42/orders"))
+	assert.True(t, CompileStringMatcher("a.*b").Matches("a\nb"))
+	assert.True(t, CompileStringMatcher("price[").Matches("price[0]"))
+	assert.False(t, CompileStringMatcher("price[").Matches("price"))
+	assert.True(t, CompileStringMatcher("").Matches("anything"))
+}
+
+func TestCompileStringMatcher_Cached(t *testing.T) {
+	assert.True(t, CompileStringMatcher("^cached$") == CompileStringMatcher("^cached$"))
+}
+
+func TestCompileStringMatcher_CacheFull_LeastRecentlyUsedEvicted(t *testing.T) {
+	first := CompileStringMatcher("^first$")
+	for i := 0; i < filterCacheSize; i++ {
+		CompileStringMatcher(fmt.Sprintf("^filler%d$", i))
+		if i == filterCacheSize/2 {
+			assert.True(t, first == CompileStringMatcher("^first$"))
+		}
+	}
+	assert.True(t, first == CompileStringMatcher("^first$"))
+	assert.True(t, filters.order.Len() <= filterCacheSize)
+
+	_, ok := filters.get("^filler0$")
+	assert.False(t, ok)
+}
+
+func TestRequestMatcher_SameResultAsControllerRequestPassesFilter(t *testing.T) {
+	req := &ExpectationRequest{
+		Method:  "POST",
+		Host:    "api.local:8080",
+		URL:     "http://api.local:8080/users/1?x=y",
+		Path:    "/users/1?x=y",
+		Body:    `{"name":"john"}`,
+		Headers: &Headers{"Content-Type": "application/json"}}
+	filters := []*ExpectationRequest{
+		nil,
+		{},
+		{Method: "POST"},
+		{Method: "GET"},
+		{Host: "api.local"},
+		{Host: "^other"},
+		{URL: "^http://api"},
+		{Path: "^/users/[0-9]+"},
+		{Path: "/orders"},
+		{Body: "john"},
+		{Body: "jane"},
+		{Headers: &Headers{"Content-Type": "json$"}},
+		{Headers: &Headers{"Content-Type": "xml"}},
+		{Headers: &Headers{"Authorization": ".*"}},
+		{Method: "POST", Path: "/users", Headers: &Headers{"Content-Type": "application"}},
+	}
+
+	for _, filter := range filters {
+		assert.Equal(t, ControllerRequestPassesFilter(req, filter), CompileRequestMatcher(filter).Matches(req), "filter %+v", filter)
+	}
+	assert.False(t, CompileRequestMatcher(&ExpectationRequest{Headers: &Headers{"A": "b"}}).Matches(&ExpectationRequest{}))
+}
+
+func TestExpectationIndex_Match_PriorityThenKey(t *testing.T) {
+	s := newTestStore(
+		Expectation{Key: "b", Priority: 1, Request: &ExpectationRequest{Path: "/users"}},
+		Expectation{Key: "a", Priority: 1, Request: &ExpectationRequest{Path: "/users"}},
+		Expectation{Key: "low", Priority: 0, Request: &ExpectationRequest{Path: "/"}},
+		Expectation{Key: "high", Priority: 5, Request: &ExpectationRequest{Path: "/orders"}})
+
+	exp, ok := s.Index().Match(&ExpectationRequest{Method: "GET", Path: "/users/1"})
+	assert.True(t, ok)
+	assert.Equal(t, "a", exp.Key)
+
+	exp, ok = s.Index().Match(&ExpectationRequest{Method: "GET", Path: "/orders"})
+	assert.True(t, ok)
+	assert.Equal(t, "high", exp.Key)
+
+	exp, ok = s.Index().Match(&ExpectationRequest{Method: "GET", Path: "/home"})
+	assert.True(t, ok)
+	assert.Equal(t, "low", exp.Key)
+
+	_, ok = s.Index().Match(&ExpectationRequest{Method: "GET", Path: "home"})
+	assert.False(t, ok)
+	assert.Equal(t, 4, s.Index().Len())
+}
+
+func TestExpectationIndex_Match_MethodAndHostPreFilter(t *testing.T) {
+	s := newTestStore(
+		Expectation{Key: "get", Priority: 2, Request: &ExpectationRequest{Method: "GET", Host: "^api"}},
+		Expectation{Key: "post", Priority: 2, Request: &ExpectationRequest{Method: "POST"}},
+		Expectation{Key: "any", Priority: 1, Request: &ExpectationRequest{Host: "local"}})
+	idx := s.Index()
+
+	match := func(method string, host string) string {
+		exp, _ := idx.Match(&ExpectationRequest{Method: method, Host: host})
+		return exp.Key
+	}
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, "get", match("GET", "api.local"))
+		assert.Equal(t, "any", match("GET", "web.local"))
+		assert.Equal(t, "post", match("POST", "web.local"))
+		assert.Equal(t, "any", match("DELETE", "api.local"))
+		assert.Equal(t, "", match("DELETE", "api.com"))
+	}
+}
+
+func TestMemoryStore_Index_RebuiltOnlyAfterChange(t *testing.T) {
+	s := newTestStore(Expectation{Key: "a"})
+	idx := s.Index()
+	assert.True(t, idx == s.Index())
+
+	s.Put(Expectation{Key: "b"})
+	assert.False(t, idx == s.Index())
+	assert.Equal(t, 1, idx.Len())
+	assert.Equal(t, 2, s.Index().Len())
+
+	s.Delete("a")
+	assert.Equal(t, 1, s.Index().Len())
+}
+
+func TestControllerMatchExpectation_NamespaceStore(t *testing.T) {
+	s := newTestStore(Expectation{Key: "a", Request: &ExpectationRequest{Path: "/a"}})
+	exp, ok := ControllerMatchExpectation(&ExpectationRequest{Path: "/a"}, s)
+	assert.True(t, ok)
+	assert.Equal(t, "a", exp.Key)
+}
+
+// benchmarkExpectations returns n expectations for 100 hosts and 4 methods with regex path filters
+func benchmarkExpectations(n int) []Expectation {
+	methods := []string{"GET", "POST", "PUT", "DELETE"}
+	exps := make([]Expectation, 0, n)
+	for i := 0; i < n; i++ {
+		exps = append(exps, Expectation{
+			Key:      fmt.Sprintf("exp_%05d", i),
+			Priority: i % 10,
+			Request: &ExpectationRequest{
+				Method:  methods[i%len(methods)],
+				Host:    fmt.Sprintf("^host%d\\.local", i%100),
+				Path:    fmt.Sprintf("^/api/v1/items/%d(\\?.*)?$", i),
+				Headers: &Headers{"Accept": "json"}},
+			Response: &ExpectationResponse{HTTPCode: 200, Body: "item"}})
+	}
+	return exps
+}
+
+func benchmarkRequest(i int) *ExpectationRequest {
+	methods := []string{"GET", "POST", "PUT", "DELETE"}
+	return &ExpectationRequest{
+		Method:  methods[i%len(methods)],
+		Host:    fmt.Sprintf("host%d.local", i%100),
+		Path:    fmt.Sprintf("/api/v1/items/%d?page=1", i),
+		Headers: &Headers{"Accept": "application/json"}}
+}
+
+// benchmarkWithoutLogs disables logs, so benchmark measures matching instead of writing logs. Returns function restoring debug level
+func benchmarkWithoutLogs(b *testing.B) func() {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	return func() { zerolog.SetGlobalLevel(zerolog.DebugLevel) }
+}
+
+func BenchmarkExpectationIndex_Match_10k(b *testing.B) {
+	s := newTestStore(benchmarkExpectations(10000)...)
+	s.Index()
+	requests := []*ExpectationRequest{benchmarkRequest(1), benchmarkRequest(5000), benchmarkRequest(9999)}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, ok := s.Index().Match(requests[i%len(requests)]); !ok {
+			b.Fatal("request isn't matched")
+		}
+	}
+}
+
+func BenchmarkExpectationIndex_Unmatched_10k(b *testing.B) {
+	s := newTestStore(benchmarkExpectations(10000)...)
+	req := benchmarkRequest(5000)
+	req.Path = "/api/v2/unknown"
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, ok := s.Index().Match(req); ok {
+			b.Fatal("request is matched")
+		}
+	}
+}
+
+// BenchmarkLinearMatch_10k is matching used before index: sorting and checking filters compiled on every request
+func BenchmarkLinearMatch_10k(b *testing.B) {
+	defer benchmarkWithoutLogs(b)()
+	s := newTestStore(benchmarkExpectations(10000)...)
+	req := benchmarkRequest(5000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ordered := make([]Expectation, 0, len(s.Snapshot()))
+		for _, exp := range s.Snapshot() {
+			ordered = append(ordered, exp)
+		}
+		sort.Slice(ordered, func(i, j int) bool { return ordered[i].Priority > ordered[j].Priority })
+		for j := 0; j < len(ordered); j++ {
+			if ControllerRequestPassesFilter(req, ordered[j].Request) {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkHandlerDefault_10k(b *testing.B) {
+	defer benchmarkWithoutLogs(b)()
+	previous := ControllerGetStore(nil)
+	defer ControllerSetStore(previous)
+	ControllerSetStore(newTestStore(benchmarkExpectations(10000)...))
+	JournalSetSize(0)
+	defer JournalSetSize(journalDefaultSize)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n := i % 10000
+		r := httptest.NewRequest(benchmarkRequest(n).Method, fmt.Sprintf("http://host%d.local/api/v1/items/%d", n%100, n), nil)
+		r.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		HandlerDefault(w, r)
+		if w.Code != 200 {
+			b.Fatalf("unexpected response code %d", w.Code)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// mirrorDiffsLimit is max number of stored mirror diffs, the oldest diffs are dropped
+const mirrorDiffsLimit = 1000
+
+// mirrorDefaultTimeout is timeout in seconds of request to mirror target, so requests to hanging target don't pile up
+const mirrorDefaultTimeout = 30
+
+// mirrorDefaultIgnoreHeaders are headers which differ for every response
+var mirrorDefaultIgnoreHeaders = []string{"Date", "Content-Length"}
+
+// MirrorDifference is a single difference between primary and mirror responses
+type MirrorDifference struct {
+	Field   string      `json:"field"`
+	Primary interface{} `json:"primary"`
+	Mirror  interface{} `json:"mirror"`
+}
+
+// MirrorDiff is a result of comparison of primary and mirror responses for single request
+type MirrorDiff struct {
+	Key         string             `json:"key"`
+	Time        time.Time          `json:"time"`
+	Method      string             `json:"method"`
+	Path        string             `json:"path"`
+	Error       string             `json:"error,omitempty"`
+	Differences []MirrorDifference `json:"differences,omitempty"`
+
+	namespace string
+}
+
+var mirrorDiffs = []MirrorDiff{}
+
+var mirrorMu sync.Mutex
+
+// MirrorGetDiffs returns copy of mirror diffs recorded in namespace
+func MirrorGetDiffs(namespace string) []MirrorDiff {
+	mirrorMu.Lock()
+	defer mirrorMu.Unlock()
+
+	diffs := []MirrorDiff{}
+	for _, diff := range mirrorDiffs {
+		if diff.namespace == namespace {
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs
+}
+
+// MirrorResetDiffs removes mirror diffs recorded in namespace
+func MirrorResetDiffs(namespace string) {
+	mirrorMu.Lock()
+	defer mirrorMu.Unlock()
+
+	kept := []MirrorDiff{}
+	for _, diff := range mirrorDiffs {
+		if diff.namespace != namespace {
+			kept = append(kept, diff)
+		}
+	}
+	mirrorDiffs = kept
+}
+
+func mirrorAddDiff(diff MirrorDiff) {
+	mirrorMu.Lock()
+	defer mirrorMu.Unlock()
+
+	mirrorDiffs = append(mirrorDiffs, diff)
+	if len(mirrorDiffs) > mirrorDiffsLimit {
+		mirrorDiffs = mirrorDiffs[len(mirrorDiffs)-mirrorDiffsLimit:]
+	}
+}
+
+// upstreamResponseFromExpectation converts mocked response to the same form as response from forward target
+func upstreamResponseFromExpectation(resp *ExpectationResponse) *upstreamResponse {
+	header := http.Header{}
+	if resp.Headers != nil {
+		for name, value := range *resp.Headers {
+			header.Set(name, value)
+		}
+	}
+	return &upstreamResponse{StatusCode: resp.HTTPCode, Header: header, Trailer: http.Header{}, Body: []byte(resp.Body)}
+}
+
+// startMirror sends request to mirror target in background if expectation has mirror block
+func startMirror(exp Expectation, req *ExpectationRequest, primary *upstreamResponse) {
+	if exp.Mirror == nil || primary == nil {
+		return
+	}
+	go MirrorRequest(exp.Key, req, exp.Mirror, primary)
+}
+
+// MirrorRequest sends request to mirror target, compares response with primary one and records differences
+func MirrorRequest(key string, req *ExpectationRequest, mirror *ExpectationMirror, primary *upstreamResponse) {
+	fLog := log.With().Str("function", "MirrorRequest").Str("key", key).Logger()
+
+	diff := MirrorDiff{Key: key, Time: time.Now(), Method: req.Method, Path: req.Path, namespace: req.namespace}
+
+	fwd := &ExpectationForward{Scheme: mirror.Scheme, Host: mirror.Host, Headers: mirror.Headers}
+	httpReq := ControllerCreateHTTPRequest(req, fwd)
+	if httpReq == nil {
+		return
+	}
+
+	timeout := mirror.Timeout
+	if timeout <= 0 {
+		timeout = mirrorDefaultTimeout
+	}
+	resp, err := forwardClient(time.Second * timeout).Do(httpReq)
+	if err != nil {
+		fLog.Error().Err(err).Msg("Mirror target is unavailable")
+		diff.Error = err.Error()
+		mirrorAddDiff(diff)
+		return
+	}
+
+	mirrorResp, err := readUpstreamResponse(resp, true)
+	if err != nil {
+		fLog.Error().Err(err).Msg("Can't read response from mirror target")
+		diff.Error = err.Error()
+		mirrorAddDiff(diff)
+		return
+	}
+
+	ignoreHeaders := append(append([]string{}, mirrorDefaultIgnoreHeaders...), mirror.IgnoreHeaders...)
+	diff.Differences = MirrorCompareResponses(primary, mirrorResp, ignoreHeaders)
+	if len(diff.Differences) == 0 {
+		fLog.Debug().Msg("Mirror response is equal to primary response")
+		return
+	}
+	fLog.Info().Msgf("Mirror response has %d differences", len(diff.Differences))
+	mirrorAddDiff(diff)
+}
+
+// MirrorCompareResponses returns list of differences in status code, headers and body
+func MirrorCompareResponses(primary *upstreamResponse, mirror *upstreamResponse, ignoreHeaders []string) []MirrorDifference {
+	differences := []MirrorDifference{}
+
+	if primary.StatusCode != mirror.StatusCode {
+		differences = append(differences, MirrorDifference{Field: "httpcode", Primary: primary.StatusCode, Mirror: mirror.StatusCode})
+	}
+
+	differences = append(differences, mirrorCompareHeaders(primary.Header, mirror.Header, ignoreHeaders)...)
+
+	primaryBody := mirrorDecodedBody(primary)
+	mirrorBody := mirrorDecodedBody(mirror)
+	if bytes.Equal(primaryBody, mirrorBody) {
+		return differences
+	}
+
+	var primaryJSON, mirrorJSON interface{}
+	if unmarshalJSON(primaryBody, &primaryJSON) == nil && unmarshalJSON(mirrorBody, &mirrorJSON) == nil {
+		return append(differences, MirrorCompareJSON("body", primaryJSON, mirrorJSON)...)
+	}
+	return append(differences, MirrorDifference{Field: "body", Primary: string(primaryBody), Mirror: string(mirrorBody)})
+}
+
+func mirrorCompareHeaders(primary http.Header, mirror http.Header, ignoreHeaders []string) []MirrorDifference {
+	ignored := map[string]bool{"Content-Encoding": true}
+	for _, name := range ignoreHeaders {
+		ignored[http.CanonicalHeaderKey(name)] = true
+	}
+
+	names := map[string]bool{}
+	for name := range primary {
+		names[name] = true
+	}
+	for name := range mirror {
+		names[name] = true
+	}
+	sortedNames := []string{}
+	for name := range names {
+		if !ignored[http.CanonicalHeaderKey(name)] {
+			sortedNames = append(sortedNames, name)
+		}
+	}
+	sort.Strings(sortedNames)
+
+	differences := []MirrorDifference{}
+	for _, name := range sortedNames {
+		primaryValue := strings.Join(primary[name], ",")
+		mirrorValue := strings.Join(mirror[name], ",")
+		if primaryValue != mirrorValue {
+			differences = append(differences, MirrorDifference{Field: "header." + name, Primary: primaryValue, Mirror: mirrorValue})
+		}
+	}
+	return differences
+}
+
+// mirrorDecodedBody returns body without content encoding, primary forward response can be not decoded
+func mirrorDecodedBody(resp *upstreamResponse) []byte {
+	reader, err := decodeContentEncoding(resp.Header.Get("Content-Encoding"), resp.Body)
+	if err != nil || reader == nil {
+		return resp.Body
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return resp.Body
+	}
+	return body
+}
+
+// MirrorCompareJSON returns structural differences of two decoded JSON values. Field is a path to value like body.a[0]
+func MirrorCompareJSON(path string, primary interface{}, mirror interface{}) []MirrorDifference {
+	switch primaryValue := primary.(type) {
+	case map[string]interface{}:
+		mirrorValue, ok := mirror.(map[string]interface{})
+		if !ok {
+			break
+		}
+		names := []string{}
+		for name := range primaryValue {
+			names = append(names, name)
+		}
+		for name := range mirrorValue {
+			if _, ok := primaryValue[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		differences := []MirrorDifference{}
+		for _, name := range names {
+			childPath := path + "." + name
+			primaryChild, inPrimary := primaryValue[name]
+			mirrorChild, inMirror := mirrorValue[name]
+			if !inPrimary || !inMirror {
+				differences = append(differences, MirrorDifference{Field: childPath, Primary: primaryChild, Mirror: mirrorChild})
+				continue
+			}
+			differences = append(differences, MirrorCompareJSON(childPath, primaryChild, mirrorChild)...)
+		}
+		return differences
+	case []interface{}:
+		mirrorValue, ok := mirror.([]interface{})
+		if !ok {
+			break
+		}
+		differences := []MirrorDifference{}
+		for i := 0; i < len(primaryValue) || i < len(mirrorValue); i++ {
+			childPath := fmt.Sprintf("%s[%d]", path, i)
+			if i >= len(primaryValue) {
+				differences = append(differences, MirrorDifference{Field: childPath, Mirror: mirrorValue[i]})
+				continue
+			}
+			if i >= len(mirrorValue) {
+				differences = append(differences, MirrorDifference{Field: childPath, Primary: primaryValue[i]})
+				continue
+			}
+			differences = append(differences, MirrorCompareJSON(childPath, primaryValue[i], mirrorValue[i])...)
+		}
+		return differences
+	}
+
+	if reflect.DeepEqual(primary, mirror) {
+		return nil
+	}
+	return []MirrorDifference{{Field: path, Primary: primary, Mirror: mirror}}
+}
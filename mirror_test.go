@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirrorCompareResponses_EqualResponses_NoDifferences(t *testing.T) {
+	primary := &upstreamResponse{StatusCode: http.StatusOK, Header: http.Header{"X-A": {"1"}}, Body: []byte(`{"a":1}`)}
+	mirror := &upstreamResponse{StatusCode: http.StatusOK, Header: http.Header{"X-A": {"1"}, "Date": {"now"}}, Body: []byte(`{ "a": 1 }`)}
+	assert.Empty(t, MirrorCompareResponses(primary, mirror, mirrorDefaultIgnoreHeaders))
+}
+
+func TestMirrorCompareResponses_StatusAndHeaders_Differences(t *testing.T) {
+	primary := &upstreamResponse{StatusCode: http.StatusOK, Header: http.Header{"X-A": {"1"}, "X-Ignored": {"1"}}}
+	mirror := &upstreamResponse{StatusCode: http.StatusNotFound, Header: http.Header{"X-A": {"2"}, "X-B": {"3"}}}
+
+	differences := MirrorCompareResponses(primary, mirror, []string{"x-ignored"})
+	assert.Equal(t, []MirrorDifference{
+		{Field: "httpcode", Primary: http.StatusOK, Mirror: http.StatusNotFound},
+		{Field: "header.X-A", Primary: "1", Mirror: "2"},
+		{Field: "header.X-B", Primary: "", Mirror: "3"}}, differences)
+}
+
+func TestMirrorCompareResponses_TextBody_Difference(t *testing.T) {
+	primary := &upstreamResponse{StatusCode: http.StatusOK, Header: http.Header{}, Body: []byte("abc")}
+	mirror := &upstreamResponse{StatusCode: http.StatusOK, Header: http.Header{}, Body: []byte("abd")}
+	assert.Equal(t, []MirrorDifference{{Field: "body", Primary: "abc", Mirror: "abd"}},
+		MirrorCompareResponses(primary, mirror, nil))
+}
+
+func TestMirrorCompareJSON_NestedValues_Differences(t *testing.T) {
+	var primary, mirror interface{}
+	assert.NoError(t, unmarshalJSON([]byte(`{"a":{"b":1,"c":[1,2]},"d":"x"}`), &primary))
+	assert.NoError(t, unmarshalJSON([]byte(`{"a":{"b":2,"c":[1]},"e":true}`), &mirror))
+
+	differences := MirrorCompareJSON("body", primary, mirror)
+	fields := []string{}
+	for _, difference := range differences {
+		fields = append(fields, difference.Field)
+	}
+	assert.Equal(t, []string{"body.a.b", "body.a.c[1]", "body.d", "body.e"}, fields)
+}
+
+func TestMirrorCompareJSON_DifferentTypes_Difference(t *testing.T) {
+	differences := MirrorCompareJSON("body", map[string]interface{}{}, []interface{}{})
+	assert.Len(t, differences, 1)
+	assert.Equal(t, "body", differences[0].Field)
+}
+
+func TestMirrorAddDiff_LimitReached_OldestDropped(t *testing.T) {
+	MirrorResetDiffs("")
+	defer MirrorResetDiffs("")
+
+	for i := 0; i <= mirrorDiffsLimit; i++ {
+		mirrorAddDiff(MirrorDiff{Key: "k", Path: string(rune('a' + i%26))})
+	}
+	diffs := MirrorGetDiffs("")
+	assert.Len(t, diffs, mirrorDiffsLimit)
+	assert.Equal(t, "b", diffs[0].Path)
+}
+
+func TestMirrorGetDiffs_Namespace_OnlyDiffsOfNamespace(t *testing.T) {
+	MirrorResetDiffs("")
+	defer MirrorResetDiffs("")
+	defer MirrorResetDiffs("suite1")
+
+	mirrorAddDiff(MirrorDiff{Key: "default"})
+	mirrorAddDiff(MirrorDiff{Key: "ns", namespace: "suite1"})
+
+	assert.Equal(t, "ns", MirrorGetDiffs("suite1")[0].Key)
+	MirrorResetDiffs("suite1")
+	assert.Empty(t, MirrorGetDiffs("suite1"))
+	assert.Len(t, MirrorGetDiffs(""), 1)
+}
+
+func TestMirrorRequest_TargetHangs_TimeoutRecorded(t *testing.T) {
+	MirrorResetDiffs("")
+	defer MirrorResetDiffs("")
+
+	release := make(chan struct{})
+	mirrorServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer mirrorServer.Close()
+	defer close(release)
+	mirrorServerURL, err := url.Parse(mirrorServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mirror := &ExpectationMirror{Scheme: mirrorServerURL.Scheme, Host: mirrorServerURL.Host, Timeout: 1}
+	MirrorRequest("mirror_timeout", &ExpectationRequest{Method: "GET", Path: "/mirror_timeout"}, mirror, cacheTestResponse("primary"))
+
+	diffs := MirrorGetDiffs("")
+	assert.Len(t, diffs, 1)
+	assert.Contains(t, diffs[0].Error, "Timeout")
+}
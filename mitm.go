@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	mitmCAValidity   = 10 * 365 * 24 * time.Hour
+	mitmLeafValidity = 365 * 24 * time.Hour
+)
+
+// MITM is certificate authority which mints certificates for intercepted HTTPS hosts
+type MITM struct {
+	ca     *x509.Certificate
+	caKey  crypto.Signer
+	caPEM  []byte
+	mu     sync.Mutex
+	leaves map[string]*tls.Certificate
+}
+
+var mitm *MITM
+
+var mitmMu sync.Mutex
+
+// MITMGet returns certificate authority for HTTPS interception or nil if interception is disabled
+func MITMGet() *MITM {
+	mitmMu.Lock()
+	defer mitmMu.Unlock()
+
+	return mitm
+}
+
+// MITMSet enables HTTPS interception with certificate authority. nil disables interception
+func MITMSet(m *MITM) {
+	mitmMu.Lock()
+	defer mitmMu.Unlock()
+
+	mitm = m
+}
+
+func mitmSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// MITMNewCA generates new self-signed certificate authority
+func MITMNewCA() (*MITM, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := mitmSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "gozzmock CA", Organization: []string{"gozzmock"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(mitmCAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MITM{
+		ca:     ca,
+		caKey:  key,
+		caPEM:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		leaves: map[string]*tls.Certificate{}}, nil
+}
+
+// MITMLoadCA loads certificate authority from PEM files
+func MITMLoadCA(certFile string, keyFile string) (*MITM, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	if !ca.IsCA {
+		return nil, fmt.Errorf("certificate %s is not a CA", certFile)
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("CA private key can't be used for signing")
+	}
+
+	return &MITM{
+		ca:     ca,
+		caKey:  key,
+		caPEM:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pair.Certificate[0]}),
+		leaves: map[string]*tls.Certificate{}}, nil
+}
+
+// MITMLoadOrCreateCA loads certificate authority from files. If files don't exist, new CA is generated and saved
+func MITMLoadOrCreateCA(certFile string, keyFile string) (*MITM, error) {
+	if certFile == "" || keyFile == "" {
+		return MITMNewCA()
+	}
+	if _, err := os.Stat(certFile); err == nil {
+		return MITMLoadCA(certFile, keyFile)
+	}
+
+	m, err := MITMNewCA()
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(m.caKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(certFile, m.caPEM, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// CACertificatePEM returns certificate of authority which should be trusted by clients
+func (m *MITM) CACertificatePEM() []byte {
+	return m.caPEM
+}
+
+// CertificateFor returns certificate for host signed by authority. Certificates are cached
+func (m *MITM) CertificateFor(host string) (*tls.Certificate, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if leaf, ok := m.leaves[host]; ok {
+		return leaf, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := mitmSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host, Organization: []string{"gozzmock"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(mitmLeafValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, m.ca, &key.PublicKey, m.caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf := &tls.Certificate{Certificate: [][]byte{der, m.ca.Raw}, PrivateKey: key}
+	m.leaves[host] = leaf
+	return leaf, nil
+}
+
+// mitmListener is a listener which returns single connection
+type mitmListener struct {
+	conn net.Conn
+	once sync.Once
+	done chan struct{}
+}
+
+func (l *mitmListener) Accept() (net.Conn, error) {
+	var conn net.Conn
+	l.once.Do(func() { conn = l.conn })
+	if conn != nil {
+		return conn, nil
+	}
+	<-l.done
+	return nil, errors.New("mitm listener is closed")
+}
+
+func (l *mitmListener) Close() error {
+	return nil
+}
+
+func (l *mitmListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// mitmConn notifies listener when connection is closed
+type mitmConn struct {
+	net.Conn
+	once sync.Once
+	done chan struct{}
+}
+
+func (c *mitmConn) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return c.Conn.Close()
+}
+
+// bufferedConn reads data buffered by http server before hijacking
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// mitmConnect terminates TLS of CONNECT tunnel with minted certificate and handles HTTPS requests as proxied ones
+func mitmConnect(w http.ResponseWriter, r *http.Request, m *MITM) {
+	fLog := log.With().Str("function", "mitmConnect").Logger()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		fLog.Error().Msg("Connection can't be hijacked")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	clientConn, clientBuf, err := hijacker.Hijack()
+	if err != nil {
+		fLog.Error().Err(err).Msg("Can't hijack connection")
+		return
+	}
+
+	_, err = clientConn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+	if err != nil {
+		clientConn.Close()
+		return
+	}
+
+	connectHost := r.Host
+	tlsConn := tls.Server(&bufferedConn{Conn: clientConn, reader: clientBuf.Reader}, &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if hello.ServerName != "" {
+				return m.CertificateFor(hello.ServerName)
+			}
+			return m.CertificateFor(connectHost)
+		}})
+
+	fLog.Info().Msgf("Intercept HTTPS traffic to %s", connectHost)
+	done := make(chan struct{})
+	listener := &mitmListener{conn: &mitmConn{Conn: tlsConn, done: done}, done: done}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// request inside of tunnel is handled as request in absolute-form
+		r.URL.Scheme = "https"
+		r.URL.Host = r.Host
+		if r.URL.Host == "" {
+			r.URL.Host = connectHost
+		}
+		LogRequest(r)
+		HandlerDefault(w, r)
+	})}
+	go server.Serve(listener)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mitmTestPool(t *testing.T, m *MITM) *x509.CertPool {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(m.CACertificatePEM()) {
+		t.Fatal("can't add CA certificate to pool")
+	}
+	return pool
+}
+
+func TestMITMCertificateFor_Host_SignedByCA(t *testing.T) {
+	m, err := MITMNewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, host := range []string{"api.example.com:443", "127.0.0.1"} {
+		cert, err := m.CertificateFor(host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		hostname := host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			hostname = h
+		}
+		_, err = leaf.Verify(x509.VerifyOptions{DNSName: hostname, Roots: mitmTestPool(t, m)})
+		assert.NoError(t, err)
+	}
+}
+
+func TestMITMCertificateFor_SameHost_Cached(t *testing.T) {
+	m, err := MITMNewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert1, err := m.CertificateFor("api.example.com")
+	assert.NoError(t, err)
+	cert2, err := m.CertificateFor("API.example.com:443")
+	assert.NoError(t, err)
+	assert.True(t, cert1 == cert2)
+}
+
+func TestMITMLoadOrCreateCA_NoFiles_CreatedAndLoaded(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "ca.pem")
+	keyFile := filepath.Join(dir, "ca.key")
+
+	created, err := MITMLoadOrCreateCA(certFile, keyFile)
+	assert.NoError(t, err)
+	loaded, err := MITMLoadOrCreateCA(certFile, keyFile)
+	assert.NoError(t, err)
+	assert.Equal(t, created.CACertificatePEM(), loaded.CACertificatePEM())
+
+	cert, err := loaded.CertificateFor("api.example.com")
+	assert.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.NoError(t, err)
+	_, err = leaf.Verify(x509.VerifyOptions{DNSName: "api.example.com", Roots: mitmTestPool(t, created)})
+	assert.NoError(t, err)
+}
+
+func TestMITMLoadCA_MissingFiles_Error(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+
+	_, err := MITMLoadCA(filepath.Join(dir, "missing.pem"), filepath.Join(dir, "missing.key"))
+	assert.Error(t, err)
+}
+
+func TestMITMConnect_HTTPSRequest_Mocked(t *testing.T) {
+	m, err := MITMNewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	MITMSet(m)
+	defer MITMSet(nil)
+
+	exp := Expectation{
+		Key:      "mitm",
+		Request:  &ExpectationRequest{URL: "^https://mocked.example.com/mitm$"},
+		Response: &ExpectationResponse{HTTPCode: http.StatusOK, Body: "mocked https"},
+		Priority: 10}
+	ControllerAddExpectation(exp.Key, exp, nil)
+	defer ControllerRemoveExpectation(exp.Key, nil)
+
+	proxyServer := httptest.NewServer(ProxyHandler(http.NewServeMux()))
+	defer proxyServer.Close()
+	proxyURL, err := url.Parse(proxyServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{RootCAs: mitmTestPool(t, m)}}}
+
+	resp, err := client.Get("https://mocked.example.com/mitm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "mocked https", string(body))
+}
+
+func TestHandlerCACertificate(t *testing.T) {
+	req, err := http.NewRequest("GET", "/gozzmock/ca.pem", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpTestResponseRecorder := httptest.NewRecorder()
+	HandlerCACertificate(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusNotFound, httpTestResponseRecorder.Code)
+
+	m, err := MITMNewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	MITMSet(m)
+	defer MITMSet(nil)
+
+	httpTestResponseRecorder = httptest.NewRecorder()
+	HandlerCACertificate(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusOK, httpTestResponseRecorder.Code)
+	assert.Equal(t, string(m.CACertificatePEM()), httpTestResponseRecorder.Body.String())
+}
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha1"
 	"encoding/json"
+	"fmt"
 	"io"
-	"strings"
+	"io/ioutil"
+	"reflect"
 	"time"
-
-	"github.com/rs/zerolog/log"
 )
 
 // Headers are HTTP headers
@@ -15,16 +17,68 @@ type Headers map[string]string
 // ExpectationRequest is filter for incoming requests
 type ExpectationRequest struct {
 	Method  string   `json:"method"`
+	Host    string   `json:"host,omitempty"`
+	URL     string   `json:"url,omitempty"`
 	Path    string   `json:"path"`
 	Body    string   `json:"body"`
 	Headers *Headers `json:"headers,omitempty"`
+	// proxied is true for requests in absolute-form, when gozzmock is used as HTTP proxy
+	proxied bool
+	// namespace is namespace of received request
+	namespace string
 }
 
 // ExpectationForward is forward action if request passes filter
 type ExpectationForward struct {
-	Scheme  string   `json:"scheme"`
-	Host    string   `json:"host"`
-	Headers *Headers `json:"headers,omitempty"`
+	Scheme    string                `json:"scheme"`
+	Host      string                `json:"host"`
+	Headers   *Headers              `json:"headers,omitempty"`
+	Decode    bool                  `json:"decode,omitempty"`
+	Transform *ExpectationTransform `json:"transform,omitempty"`
+	Hosts     []string              `json:"hosts,omitempty"`
+	Strategy  string                `json:"strategy,omitempty"`
+	MaxFails  int                   `json:"maxfails,omitempty"`
+	EjectTime time.Duration         `json:"ejecttime,omitempty"`
+	Cache     *ExpectationCache     `json:"cache,omitempty"`
+	Timeout   time.Duration         `json:"timeout,omitempty"`
+	OnError   *ExpectationOnError   `json:"onerror,omitempty"`
+}
+
+// ExpectationOnError is behaviour when forward target is unavailable.
+// Without fallback response, client gets 502 or 504 with diagnostic body
+type ExpectationOnError struct {
+	Response  *ExpectationResponse `json:"response,omitempty"`
+	Threshold int                  `json:"threshold,omitempty"`
+	CoolDown  time.Duration        `json:"cooldown,omitempty"`
+}
+
+// ExpectationCache stores responses of forward target. Responses are cached by method, path and listed headers
+type ExpectationCache struct {
+	TTL     time.Duration `json:"ttl,omitempty"`
+	MaxSize int           `json:"maxsize,omitempty"`
+	Headers []string      `json:"headers,omitempty"`
+}
+
+// ExpectationJSONPathSet sets value to the element of JSON body selected by path
+type ExpectationJSONPathSet struct {
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ExpectationReplace replaces all matches of regex in text body
+type ExpectationReplace struct {
+	Regex       string `json:"regex"`
+	Replacement string `json:"replacement"`
+}
+
+// ExpectationTransform modifies forwarded response before it is returned to client
+type ExpectationTransform struct {
+	HTTPCode      int                      `json:"httpcode,omitempty"`
+	Headers       *Headers                 `json:"headers,omitempty"`
+	RemoveHeaders []string                 `json:"removeheaders,omitempty"`
+	MergePatch    json.RawMessage          `json:"mergepatch,omitempty"`
+	Set           []ExpectationJSONPathSet `json:"set,omitempty"`
+	Replace       []ExpectationReplace     `json:"replace,omitempty"`
 }
 
 // ExpectationResponse is response action if request passes filter
@@ -34,14 +88,26 @@ type ExpectationResponse struct {
 	Headers  *Headers `json:"headers,omitempty"`
 }
 
+// ExpectationMirror is a secondary target which receives copy of request.
+// Its response is compared with the response of the primary action
+type ExpectationMirror struct {
+	Scheme        string        `json:"scheme"`
+	Host          string        `json:"host"`
+	Headers       *Headers      `json:"headers,omitempty"`
+	IgnoreHeaders []string      `json:"ignoreheaders,omitempty"`
+	Timeout       time.Duration `json:"timeout,omitempty"`
+}
+
 // Expectation is single set of rules: expected request and prepared action
 type Expectation struct {
 	Key      string               `json:"key"`
 	Request  *ExpectationRequest  `json:"request,omitempty"`
 	Forward  *ExpectationForward  `json:"forward,omitempty"`
 	Response *ExpectationResponse `json:"response,omitempty"`
+	Mirror   *ExpectationMirror   `json:"mirror,omitempty"`
 	Delay    time.Duration        `json:"delay,omitempty"`
 	Priority int                  `json:"priority,omitempty"`
+	Labels   map[string]string    `json:"labels,omitempty"`
 }
 
 // ExpectationRemove removes action from list by key
@@ -49,48 +115,109 @@ type ExpectationRemove struct {
 	Key string `json:"key"`
 }
 
+// ExpectationRemoveFilter removes expectations which keys pass filter and labels match selector
+type ExpectationRemoveFilter struct {
+	Key    string `json:"key,omitempty"`
+	Labels string `json:"labels,omitempty"`
+}
+
 // Expectations is a map for expectations
 type Expectations map[string]Expectation
 
-// ExpectationsInt is for sorting expectations by priority. the lowest priority is 0
-type ExpectationsInt map[int]Expectation
+// ExpectationsPage is a page of expectations list sorted by key
+type ExpectationsPage struct {
+	Total        int           `json:"total"`
+	Offset       int           `json:"offset"`
+	Limit        int           `json:"limit"`
+	Expectations []Expectation `json:"expectations"`
+}
 
-func (exps ExpectationsInt) Len() int           { return len(exps) }
-func (exps ExpectationsInt) Swap(i, j int)      { exps[i], exps[j] = exps[j], exps[i] }
-func (exps ExpectationsInt) Less(i, j int) bool { return exps[i].Priority > exps[j].Priority }
+// ExpectationFromReadCloser decodes readCloser to expectaion. Expectation is validated, all invalid fields are
+// returned at once. Returned error is *APIError
+func ExpectationFromReadCloser(readCloser io.ReadCloser) (Expectation, error) {
+	defer readCloser.Close()
 
-// ExpectationFromReadCloser decodes readCloser to expectaion
-func ExpectationFromReadCloser(readCloser io.ReadCloser) Expectation {
-	fLog := log.With().Str("function", "ExpectationFromReadCloser").Logger()
+	body, err := ioutil.ReadAll(readCloser)
+	if err != nil {
+		return Expectation{}, APIBadRequest("can't read body: " + err.Error())
+	}
+	return ExpectationFromBytes(body, "")
+}
 
+// ExpectationFromBytes decodes and validates expectation. If key is set, expectation gets this key
+// when key isn't set in body, and other key in body is an error. Returned error is *APIError
+func ExpectationFromBytes(body []byte, key string) (Expectation, error) {
 	exp := Expectation{}
-	bodyDecoder := json.NewDecoder(readCloser)
-	defer readCloser.Close()
-	err := bodyDecoder.Decode(&exp)
-	if err != nil {
-		fLog.Panic().Err(err)
-		return exp
+	if apiErr := APIDecodeJSON(bytes.NewReader(body), &exp); apiErr != nil {
+		return exp, apiErr
+	}
+
+	var raw interface{}
+	json.Unmarshal(body, &raw)
+	fields := ValidateUnknownFields(raw, reflect.TypeOf(exp), "")
+	if key != "" && exp.Key == "" {
+		exp.Key = key
+	}
+	if key != "" && exp.Key != key {
+		fields = append(fields, APIFieldError{Field: "key", Message: fmt.Sprintf("key %s should be equal to key %s in URL", exp.Key, key)})
+	}
+	fields = append(fields, ExpectationValidate(exp)...)
+	if len(fields) > 0 {
+		return exp, APIUnprocessable("expectation is invalid", fields...)
 	}
 	expectationSetDefaultValues(&exp)
-	return exp
+	return exp, nil
 }
 
-// ExpectationsFromString decodes string with array of expectations to array of expectaion objects
-func ExpectationsFromString(str string) []Expectation {
-	fLog := log.With().Str("function", "ExpectationsFromString").Logger()
+// ExpectationETag returns entity tag of expectation, it is changed when any field of expectation is changed
+func ExpectationETag(exp Expectation) string {
+	expjson, _ := json.Marshal(exp)
+	return fmt.Sprintf("\"%x\"", sha1.Sum(expjson))
+}
 
-	exps := make([]Expectation, 0)
+// ExpectationsFromString decodes string with array of expectations to array of expectaion objects.
+// Expectations are validated, all invalid fields are returned at once. Returned error is *APIError
+func ExpectationsFromString(str string) ([]Expectation, error) {
+	return expectationsFromBytes([]byte(str))
+}
 
-	bodyDecoder := json.NewDecoder(strings.NewReader(str))
-	err := bodyDecoder.Decode(&exps)
+// ExpectationsFromReadCloser decodes readCloser with array of expectations. Returned error is *APIError
+func ExpectationsFromReadCloser(readCloser io.ReadCloser) ([]Expectation, error) {
+	defer readCloser.Close()
+
+	body, err := ioutil.ReadAll(readCloser)
 	if err != nil {
-		fLog.Panic().Err(err)
-		return exps
+		return nil, APIBadRequest("can't read body: " + err.Error())
 	}
-	for _, exp := range exps {
-		expectationSetDefaultValues(&exp)
+	return expectationsFromBytes(body)
+}
+
+func expectationsFromBytes(body []byte) ([]Expectation, error) {
+	exps := make([]Expectation, 0)
+	if apiErr := APIDecodeJSON(bytes.NewReader(body), &exps); apiErr != nil {
+		return nil, apiErr
 	}
-	return exps
+
+	var raw interface{}
+	json.Unmarshal(body, &raw)
+	fields := ValidateUnknownFields(raw, reflect.TypeOf(exps), "")
+	keys := map[string]int{}
+	for i := range exps {
+		if first, ok := keys[exps[i].Key]; ok && exps[i].Key != "" {
+			fields = append(fields, APIFieldError{Field: fmt.Sprintf("[%d].key", i), Message: fmt.Sprintf("key %s is already used by expectation [%d]", exps[i].Key, first)})
+		} else {
+			keys[exps[i].Key] = i
+		}
+		for _, field := range ExpectationValidate(exps[i]) {
+			field.Field = fmt.Sprintf("[%d].%s", i, field.Field)
+			fields = append(fields, field)
+		}
+		expectationSetDefaultValues(&exps[i])
+	}
+	if len(fields) > 0 {
+		return nil, APIUnprocessable("expectations are invalid", fields...)
+	}
+	return exps, nil
 }
 
 // expectationSetDefaultValues sets default values after deserialization
@@ -98,4 +225,7 @@ func expectationSetDefaultValues(exp *Expectation) {
 	if exp.Forward != nil && exp.Forward.Scheme == "" {
 		exp.Forward.Scheme = "http"
 	}
+	if exp.Mirror != nil && exp.Mirror.Scheme == "" {
+		exp.Mirror.Scheme = "http"
+	}
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"io/ioutil"
+	"net/http"
 	"strings"
 	"testing"
 
@@ -9,8 +10,9 @@ import (
 )
 
 func TestExpectationsFromString(t *testing.T) {
-	str := "[{\"key\": \"k1\"},{\"key\": \"k2\"}]"
-	exps := ExpectationsFromString(str)
+	str := "[{\"key\": \"k1\", \"response\":{\"httpcode\":200}},{\"key\": \"k2\", \"response\":{\"httpcode\":200}}]"
+	exps, err := ExpectationsFromString(str)
+	assert.NoError(t, err)
 	assert.Equal(t, 2, len(exps))
 	assert.Equal(t, "k1", exps[0].Key)
 	assert.Equal(t, "k2", exps[1].Key)
@@ -18,7 +20,8 @@ func TestExpectationsFromString(t *testing.T) {
 
 func TestExpectationsDefaultValues(t *testing.T) {
 	str := "[{\"key\": \"k1\", \"forward\":{\"host\":\"localhost\"}}]"
-	exps := ExpectationsFromString(str)
+	exps, err := ExpectationsFromString(str)
+	assert.NoError(t, err)
 	assert.Equal(t, 1, len(exps))
 	assert.Equal(t, "k1", exps[0].Key)
 	assert.NotNil(t, exps[0].Forward)
@@ -27,7 +30,68 @@ func TestExpectationsDefaultValues(t *testing.T) {
 }
 
 func TestConvertationExpectationFromReadCloser(t *testing.T) {
-	str := "{\"key\": \"k\"}"
-	exp := ExpectationFromReadCloser(ioutil.NopCloser(strings.NewReader(str)))
+	str := "{\"key\": \"k\", \"response\":{\"httpcode\":200}}"
+	exp, err := ExpectationFromReadCloser(ioutil.NopCloser(strings.NewReader(str)))
+	assert.NoError(t, err)
 	assert.Equal(t, "k", exp.Key)
 }
+
+func TestExpectationFromReadCloser_InvalidJSON_BadRequest(t *testing.T) {
+	_, err := ExpectationFromReadCloser(ioutil.NopCloser(strings.NewReader("{\"key\": ")))
+	apiErr, ok := err.(*APIError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+}
+
+func TestExpectationFromReadCloser_WrongType_FieldError(t *testing.T) {
+	_, err := ExpectationFromReadCloser(ioutil.NopCloser(strings.NewReader("{\"key\": \"k\", \"priority\": \"high\"}")))
+	apiErr, ok := err.(*APIError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+	assert.Equal(t, []APIFieldError{{Field: "priority", Message: "JSON string can't be used as int"}}, apiErr.Fields)
+}
+
+func TestExpectationFromReadCloser_NoKey_Unprocessable(t *testing.T) {
+	_, err := ExpectationFromReadCloser(ioutil.NopCloser(strings.NewReader("{\"response\":{\"httpcode\":200}}")))
+	apiErr, ok := err.(*APIError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusUnprocessableEntity, apiErr.Status)
+	assert.Equal(t, []APIFieldError{{Field: "key", Message: "key is required"}}, apiErr.Fields)
+}
+
+func TestExpectationsFromString_NoKey_IndexInField(t *testing.T) {
+	_, err := ExpectationsFromString("[{\"key\": \"k1\", \"response\":{\"httpcode\":200}},{\"response\":{\"httpcode\":200}}]")
+	apiErr, ok := err.(*APIError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusUnprocessableEntity, apiErr.Status)
+	assert.Equal(t, "[1].key", apiErr.Fields[0].Field)
+}
+
+func TestExpectationsFromReadCloser_DuplicateKeys_Unprocessable(t *testing.T) {
+	_, err := ExpectationsFromReadCloser(ioutil.NopCloser(strings.NewReader(
+		"[{\"key\": \"k\", \"response\":{\"httpcode\":200}},{\"key\": \"k\", \"response\":{\"httpcode\":201}}]")))
+	apiErr, ok := err.(*APIError)
+	assert.True(t, ok)
+	assert.Equal(t, []APIFieldError{{Field: "[1].key", Message: "key k is already used by expectation [0]"}}, apiErr.Fields)
+}
+
+func TestExpectationFromBytes_KeyFromURL(t *testing.T) {
+	exp, err := ExpectationFromBytes([]byte("{\"response\":{\"httpcode\":200}}"), "k")
+	assert.NoError(t, err)
+	assert.Equal(t, "k", exp.Key)
+
+	_, err = ExpectationFromBytes([]byte("{\"key\":\"other\",\"response\":{\"httpcode\":200}}"), "k")
+	apiErr, ok := err.(*APIError)
+	assert.True(t, ok)
+	assert.Equal(t, []APIFieldError{{Field: "key", Message: "key other should be equal to key k in URL"}}, apiErr.Fields)
+}
+
+func TestExpectationETag_ChangedWithExpectation(t *testing.T) {
+	exp := Expectation{Key: "k", Response: &ExpectationResponse{HTTPCode: 200}}
+	etag := ExpectationETag(exp)
+	assert.Regexp(t, `^"[0-9a-f]{40}"$`, etag)
+	assert.Equal(t, etag, ExpectationETag(Expectation{Key: "k", Response: &ExpectationResponse{HTTPCode: 200}}))
+
+	exp.Response.HTTPCode = 201
+	assert.NotEqual(t, etag, ExpectationETag(exp))
+}
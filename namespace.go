@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// namespaceHeader selects namespace of request. Requests without it belong to default namespace
+	namespaceHeader = "X-Gozzmock-Namespace"
+	// namespacePathPrefix selects namespace by path: /_ns/{name}/path is handled as /path in namespace {name}
+	namespacePathPrefix = "/_ns/"
+	// namespaceStateSeparator separates namespace and key in forward state key, it can't be used in namespace name
+	namespaceStateSeparator = "\x00"
+)
+
+// namespaceNameRegexp doesn't allow /, so name is always the first path segment after /_ns/
+var namespaceNameRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// namespaces keeps map[string]Store of isolated in-memory stores of expectations. Map is copied on write,
+// so requests read it without locking. Default namespace "" uses controller store
+var namespaces atomic.Value
+
+// namespacesMu serializes changes of namespaces
+var namespacesMu sync.Mutex
+
+func init() {
+	namespaces.Store(map[string]Store{})
+}
+
+// namespacesGet returns current namespaces, map must not be changed
+func namespacesGet() map[string]Store {
+	return namespaces.Load().(map[string]Store)
+}
+
+// namespacesSet stores copy of current namespaces with store of name replaced, nil store removes namespace.
+// namespacesMu should be locked
+func namespacesSet(name string, s Store) {
+	current := namespacesGet()
+	next := make(map[string]Store, len(current)+1)
+	for n, ns := range current {
+		next[n] = ns
+	}
+	if s == nil {
+		delete(next, name)
+	} else {
+		next[name] = s
+	}
+	namespaces.Store(next)
+}
+
+// NamespaceValidateName returns error if name can't be used as namespace name
+func NamespaceValidateName(name string) error {
+	if !namespaceNameRegexp.MatchString(name) {
+		return fmt.Errorf("namespace name %s should be non-empty and contain only letters, digits, ., _ and -", name)
+	}
+	return nil
+}
+
+// NamespaceCreate creates empty namespace
+func NamespaceCreate(name string) error {
+	if err := NamespaceValidateName(name); err != nil {
+		return err
+	}
+
+	namespacesMu.Lock()
+	defer namespacesMu.Unlock()
+
+	if _, ok := namespacesGet()[name]; ok {
+		return fmt.Errorf("namespace %s already exists", name)
+	}
+	namespacesSet(name, NewMemoryStore())
+	return nil
+}
+
+// NamespaceDelete removes namespace with its expectations, journal and forward state.
+// Returns false if namespace doesn't exist
+func NamespaceDelete(name string) bool {
+	namespacesMu.Lock()
+	s, ok := namespacesGet()[name]
+	if ok {
+		namespacesSet(name, nil)
+	}
+	namespacesMu.Unlock()
+
+	if !ok || name == "" {
+		return false
+	}
+	namespaceCleanup(name, s)
+	return true
+}
+
+// NamespaceReplaceAll replaces all namespaces with stores at once. Journals and forward state of previous
+// namespaces are removed
+func NamespaceReplaceAll(stores map[string]Store) {
+	next := make(map[string]Store, len(stores))
+	for name, s := range stores {
+		next[name] = s
+	}
+
+	namespacesMu.Lock()
+	previous := namespacesGet()
+	namespaces.Store(next)
+	namespacesMu.Unlock()
+
+	for name, s := range previous {
+		namespaceCleanup(name, s)
+	}
+}
+
+// namespaceCleanup removes journal, mirror diffs and forward state of removed namespace and closes its store
+func namespaceCleanup(name string, s Store) {
+	for key := range s.Snapshot() {
+		forwardForgetState(NamespaceStateKey(name, key))
+	}
+	forwardForgetState(namespaceInternalStateKey(name, unmatchedStateName))
+	forwardForgetState(namespaceInternalStateKey(name, proxyStateName))
+	s.Close()
+	JournalResetNamespace(name)
+	MirrorResetDiffs(name)
+}
+
+// NamespaceList returns sorted names of created namespaces, default namespace isn't listed
+func NamespaceList() []string {
+	current := namespacesGet()
+	names := make([]string, 0, len(current))
+	for name := range current {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NamespaceStore returns store of namespace to be passed as storeInjection to controller.
+// Default namespace returns nil, so controller store is used
+func NamespaceStore(name string) (Store, bool) {
+	if name == "" {
+		return nil, true
+	}
+
+	s, ok := namespacesGet()[name]
+	return s, ok
+}
+
+// NamespaceOfStore returns name of namespace which store belongs to. Returns false for stores
+// which aren't used by any namespace
+func NamespaceOfStore(storeInjection Store) (string, bool) {
+	if storeInjection == nil || storeInjection == ControllerGetStore(nil) {
+		return "", true
+	}
+	for name, s := range namespacesGet() {
+		if s == storeInjection {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// NamespaceStateKey is key of forward state (cache, balancer, circuit breaker) of expectation in namespace,
+// so expectations with the same key in different namespaces don't share state
+func NamespaceStateKey(namespace string, key string) string {
+	if namespace == "" {
+		return key
+	}
+	return namespace + namespaceStateSeparator + key
+}
+
+// namespaceInternalStateKey is key of forward state of gozzmock itself in namespace, like forward of unmatched requests.
+// Name is prefixed with separator, which expectation keys can't contain, so state isn't shared with expectations
+func namespaceInternalStateKey(namespace string, name string) string {
+	return NamespaceStateKey(namespace, namespaceStateSeparator+name)
+}
+
+// NamespaceKeyOfStateKey returns expectation key of forward state key if state belongs to expectation in namespace
+func NamespaceKeyOfStateKey(namespace string, stateKey string) (string, bool) {
+	key := stateKey
+	if namespace != "" {
+		prefix := namespace + namespaceStateSeparator
+		if !strings.HasPrefix(stateKey, prefix) {
+			return "", false
+		}
+		key = stateKey[len(prefix):]
+	}
+	return key, !strings.Contains(key, namespaceStateSeparator)
+}
+
+// NamespaceHandler moves namespace from path prefix /_ns/{name} to namespace header, so admin API and
+// mocked paths are routed as without prefix
+func NamespaceHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, namespacePathPrefix) {
+			rest := strings.TrimPrefix(r.URL.Path, namespacePathPrefix)
+			name := rest
+			path := "/"
+			if i := strings.Index(rest, "/"); i >= 0 {
+				name = rest[:i]
+				path = rest[i:]
+			}
+			r.Header.Set(namespaceHeader, name)
+			r.URL.Path = path
+			r.URL.RawPath = ""
+			r.RequestURI = r.URL.RequestURI()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespaceCreate_ListAndDelete(t *testing.T) {
+	assert.NoError(t, NamespaceCreate("suite_b"))
+	assert.NoError(t, NamespaceCreate("suite_a"))
+	defer NamespaceDelete("suite_a")
+	assert.Error(t, NamespaceCreate("suite_a"))
+	assert.Error(t, NamespaceCreate(""))
+	assert.Error(t, NamespaceCreate("suite a"))
+	assert.Error(t, NamespaceCreate("suite/a"))
+
+	assert.Equal(t, []string{"suite_a", "suite_b"}, NamespaceList())
+	assert.True(t, NamespaceDelete("suite_b"))
+	assert.False(t, NamespaceDelete("suite_b"))
+	assert.Equal(t, []string{"suite_a"}, NamespaceList())
+}
+
+func TestNamespaceStore_DefaultAndCreated(t *testing.T) {
+	s, ok := NamespaceStore("")
+	assert.True(t, ok)
+	assert.Nil(t, s)
+
+	_, ok = NamespaceStore("missing")
+	assert.False(t, ok)
+
+	assert.NoError(t, NamespaceCreate("ns_exps"))
+	defer NamespaceDelete("ns_exps")
+	s, ok = NamespaceStore("ns_exps")
+	assert.True(t, ok)
+	ControllerAddExpectation("k", Expectation{Key: "k"}, s)
+	assert.Contains(t, s.List(), "k")
+	assert.NotContains(t, ControllerGetExpectations(nil), "k")
+}
+
+func TestNamespaceDelete_ForwardStateForgotten(t *testing.T) {
+	assert.NoError(t, NamespaceCreate("ns_state"))
+	s, _ := NamespaceStore("ns_state")
+	ControllerAddExpectation("fwd", Expectation{Key: "fwd"}, s)
+	ControllerAddExpectation("removed", Expectation{Key: "removed"}, s)
+	fwd := &ExpectationForward{Hosts: []string{"h1", "h2"}}
+	onError := &ExpectationOnError{Threshold: 1}
+	for _, key := range []string{"fwd", "removed"} {
+		BalancerReportFailure(NamespaceStateKey("ns_state", key), fwd, "h1")
+		BreakerReportFailure(NamespaceStateKey("ns_state", key), onError)
+	}
+
+	ControllerRemoveExpectation("removed", s)
+	assert.False(t, BreakerIsOpen(NamespaceStateKey("ns_state", "removed"), onError))
+	assert.True(t, BreakerIsOpen(NamespaceStateKey("ns_state", "fwd"), onError))
+
+	assert.True(t, NamespaceDelete("ns_state"))
+	assert.False(t, BreakerIsOpen(NamespaceStateKey("ns_state", "fwd"), onError))
+	balancersMu.Lock()
+	defer balancersMu.Unlock()
+	assert.NotContains(t, balancers, NamespaceStateKey("ns_state", "fwd"))
+	assert.NotContains(t, balancers, NamespaceStateKey("ns_state", "removed"))
+}
+
+func TestNamespaceStateKey(t *testing.T) {
+	assert.Equal(t, "k", NamespaceStateKey("", "k"))
+	assert.Equal(t, "ns\x00k", NamespaceStateKey("ns", "k"))
+	assert.NotEqual(t, NamespaceStateKey("a", "b/c"), NamespaceStateKey("a/b", "c"))
+}
+
+func TestNamespaceHandler_PathPrefix_MovedToHeader(t *testing.T) {
+	var namespace, path, requestURI string
+	handler := NamespaceHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		namespace = r.Header.Get(namespaceHeader)
+		path = r.URL.Path
+		requestURI = r.RequestURI
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/_ns/suite1/user/1?a=b", nil))
+	assert.Equal(t, "suite1", namespace)
+	assert.Equal(t, "/user/1", path)
+	assert.Equal(t, "/user/1?a=b", requestURI)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/_ns/suite2", nil))
+	assert.Equal(t, "suite2", namespace)
+	assert.Equal(t, "/", path)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/user", nil))
+	assert.Equal(t, "", namespace)
+	assert.Equal(t, "/user", path)
+}
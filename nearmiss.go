@@ -0,0 +1,90 @@
+package main
+
+import (
+	"sort"
+)
+
+// nearMissesLimit is max number of closest expectations in explanation
+const nearMissesLimit = 5
+
+// explainHeader in request asks to explain in response body why request doesn't pass any expectation
+const explainHeader = "X-Gozzmock-Explain"
+
+// NearMiss is expectation which filter request doesn't pass, with explanation of mismatched fields
+type NearMiss struct {
+	Key        string           `json:"key"`
+	Priority   int              `json:"priority"`
+	Matched    int              `json:"matched"`
+	Checked    int              `json:"checked"`
+	Mismatches []FilterMismatch `json:"mismatches"`
+}
+
+// Explanation is list of the closest expectations for request
+type Explanation struct {
+	Message    string             `json:"message,omitempty"`
+	Request    ExpectationRequest `json:"request"`
+	NearMisses []NearMiss         `json:"nearmisses"`
+}
+
+// NearMisses returns expectations ranked by closeness to request: the fewest mismatched fields first,
+// then the most specific filters, then the highest priority
+func NearMisses(req *ExpectationRequest, exps Expectations, limit int) []NearMiss {
+	nearMisses := []NearMiss{}
+	for _, exp := range exps {
+		mismatches, checked := ControllerRequestMismatches(req, exp.Request)
+		matched := checked - len(mismatches)
+		if len(mismatches) == 0 && exp.Response == nil && exp.Forward == nil {
+			mismatches = append(mismatches, FilterMismatch{
+				Field:  "action",
+				Reason: "expectation has neither response nor forward"})
+		}
+		if len(mismatches) == 0 {
+			continue
+		}
+		nearMisses = append(nearMisses, NearMiss{
+			Key:        exp.Key,
+			Priority:   exp.Priority,
+			Matched:    matched,
+			Checked:    checked,
+			Mismatches: mismatches})
+	}
+
+	sort.Slice(nearMisses, func(i, j int) bool {
+		a, b := nearMisses[i], nearMisses[j]
+		if len(a.Mismatches) != len(b.Mismatches) {
+			return len(a.Mismatches) < len(b.Mismatches)
+		}
+		if a.Matched != b.Matched {
+			return a.Matched > b.Matched
+		}
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		return a.Key < b.Key
+	})
+
+	if limit > 0 && len(nearMisses) > limit {
+		nearMisses = nearMisses[:limit]
+	}
+	return nearMisses
+}
+
+// Explain returns the closest expectations for request from namespace of request
+func Explain(req *ExpectationRequest) Explanation {
+	exps := Expectations{}
+	if nsStore, ok := NamespaceStore(req.namespace); ok {
+		exps = ControllerGetSnapshot(nsStore)
+	}
+	return Explanation{
+		Request:    *req,
+		NearMisses: NearMisses(req, exps, nearMissesLimit)}
+}
+
+// explainRequested returns true if request asks to explain why it doesn't pass any expectation
+func explainRequested(req *ExpectationRequest) bool {
+	if req.Headers == nil {
+		return false
+	}
+	value, ok := (*req.Headers)[explainHeader]
+	return ok && value != "false"
+}
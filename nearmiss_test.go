@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNearMisses_RankedByMismatches(t *testing.T) {
+	response := &ExpectationResponse{HTTPCode: 200}
+	exps := Expectations{
+		"two_mismatches":     {Key: "two_mismatches", Request: &ExpectationRequest{Method: "POST", Path: "/b"}, Response: response},
+		"one_mismatch":       {Key: "one_mismatch", Request: &ExpectationRequest{Method: "POST", Path: "/users"}, Response: response},
+		"one_mismatch_loose": {Key: "one_mismatch_loose", Request: &ExpectationRequest{Method: "POST"}, Response: response},
+		"matched":            {Key: "matched", Request: &ExpectationRequest{Method: "GET"}, Response: response},
+		"no_action":          {Key: "no_action", Request: &ExpectationRequest{Path: "/users"}},
+	}
+
+	nearMisses := NearMisses(&ExpectationRequest{Method: "GET", Path: "/users"}, exps, 3)
+	assert.Len(t, nearMisses, 3)
+	assert.Equal(t, "no_action", nearMisses[0].Key)
+	assert.Equal(t, "action", nearMisses[0].Mismatches[0].Field)
+	assert.Equal(t, "one_mismatch", nearMisses[1].Key)
+	assert.Equal(t, 1, nearMisses[1].Matched)
+	assert.Equal(t, 2, nearMisses[1].Checked)
+	assert.Equal(t, "one_mismatch_loose", nearMisses[2].Key)
+}
+
+func TestExplainRequested(t *testing.T) {
+	assert.False(t, explainRequested(&ExpectationRequest{}))
+	assert.False(t, explainRequested(&ExpectationRequest{Headers: &Headers{explainHeader: "false"}}))
+	assert.True(t, explainRequested(&ExpectationRequest{Headers: &Headers{explainHeader: "true"}}))
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// proxyStateName is name of forward state of requests proxied to original destination
+const proxyStateName = "proxy"
+
+// proxyDialTimeout is timeout to connect to the target of CONNECT tunnel
+const proxyDialTimeout = 10 * time.Second
+
+// ProxyHandler routes requests sent to gozzmock as to HTTP proxy (CONNECT and absolute-form) to HandlerDefault.
+// Admin endpoints are available only for requests in origin-form
+func ProxyHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodConnect || r.URL.IsAbs() {
+			LogRequest(r)
+			HandlerDefault(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ProxyConnect establishes tunnel between client and target host of CONNECT request.
+// If HTTPS interception is enabled, traffic of tunnel is decrypted and matched against expectations
+func ProxyConnect(w http.ResponseWriter, r *http.Request) {
+	fLog := log.With().Str("function", "ProxyConnect").Logger()
+
+	if m := MITMGet(); m != nil {
+		mitmConnect(w, r, m)
+		return
+	}
+
+	targetConn, err := net.DialTimeout("tcp", r.Host, proxyDialTimeout)
+	if err != nil {
+		fLog.Error().Err(err).Msgf("Can't connect to %s", r.Host)
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		fLog.Error().Msg("Connection can't be hijacked")
+		targetConn.Close()
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	clientConn, clientBuf, err := hijacker.Hijack()
+	if err != nil {
+		fLog.Error().Err(err).Msg("Can't hijack connection")
+		targetConn.Close()
+		return
+	}
+
+	_, err = clientConn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+	if err != nil {
+		clientConn.Close()
+		targetConn.Close()
+		return
+	}
+
+	fLog.Info().Msgf("Tunnel to %s is established", r.Host)
+	go proxyCopy(targetConn, clientBuf, clientConn)
+	go proxyCopy(clientConn, targetConn, targetConn)
+}
+
+// proxyCopy copies data in one direction of tunnel and closes both ends when done
+func proxyCopy(dst net.Conn, src io.Reader, srcConn net.Conn) {
+	io.Copy(dst, src)
+	dst.Close()
+	srcConn.Close()
+}
+
+// proxyToOriginalDestination forwards request in absolute-form to the host from request URL
+func proxyToOriginalDestination(w http.ResponseWriter, req *ExpectationRequest) {
+	fLog := log.With().Str("function", "proxyToOriginalDestination").Logger()
+
+	destination, err := url.Parse(req.URL)
+	if err != nil {
+		fLog.Error().Err(err).Msgf("Wrong destination %s", req.URL)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	fLog.Info().Msgf("No expectations for request, proxy to %s", req.URL)
+	fwd := &ExpectationForward{Scheme: destination.Scheme, Host: destination.Host, Headers: &Headers{"Via": unmatchedVia}}
+	doHTTPRequest(w, namespaceInternalStateKey(req.namespace, proxyStateName), proxyStateName, req, fwd)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newProxyTestClient starts gozzmock as HTTP proxy and returns client which uses it
+func newProxyTestClient(t *testing.T) (*http.Client, func()) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gozzmock/status", HandlerStatus)
+	mux.HandleFunc("/", HandlerDefault)
+	proxyServer := httptest.NewServer(ProxyHandler(mux))
+	proxyURL, err := url.Parse(proxyServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	return client, proxyServer.Close
+}
+
+func proxyTestGet(t *testing.T, client *http.Client, url string) (int, string) {
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestProxy_UnmatchedRequest_ForwardedToDestination(t *testing.T) {
+	originServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("response from origin " + r.URL.Path))
+	}))
+	defer originServer.Close()
+
+	client, closeProxy := newProxyTestClient(t)
+	defer closeProxy()
+
+	code, body := proxyTestGet(t, client, originServer.URL+"/proxy_unmatched")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "response from origin /proxy_unmatched", body)
+
+	// admin endpoints aren't available for proxied requests
+	code, body = proxyTestGet(t, client, originServer.URL+"/gozzmock/status")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "response from origin /gozzmock/status", body)
+}
+
+func TestProxy_UnmatchedRequest_ExpectationStateNotShared(t *testing.T) {
+	originServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("response from origin"))
+	}))
+	defer originServer.Close()
+
+	client, closeProxy := newProxyTestClient(t)
+	defer closeProxy()
+
+	// circuit of expectation with key "proxy" is open
+	onError := &ExpectationOnError{Threshold: 1, CoolDown: 10}
+	BreakerReportFailure(proxyStateName, onError)
+	defer BreakerForget(proxyStateName)
+
+	code, body := proxyTestGet(t, client, originServer.URL+"/proxy_state")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "response from origin", body)
+	assert.True(t, BreakerIsOpen(proxyStateName, onError))
+}
+
+func TestProxy_URLFilter_Mocked(t *testing.T) {
+	originServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("response from origin"))
+	}))
+	defer originServer.Close()
+
+	exp := Expectation{
+		Key:      "proxy_url",
+		Request:  &ExpectationRequest{URL: "^" + originServer.URL + "/proxy_mocked\\?a=1$"},
+		Response: &ExpectationResponse{HTTPCode: http.StatusOK, Body: "mocked"},
+		Priority: 10}
+	ControllerAddExpectation(exp.Key, exp, nil)
+	defer ControllerRemoveExpectation(exp.Key, nil)
+
+	client, closeProxy := newProxyTestClient(t)
+	defer closeProxy()
+
+	code, body := proxyTestGet(t, client, originServer.URL+"/proxy_mocked?a=1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "mocked", body)
+
+	code, body = proxyTestGet(t, client, originServer.URL+"/proxy_mocked?a=2")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "response from origin", body)
+}
+
+func TestProxy_Connect_Tunneled(t *testing.T) {
+	originServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("response from tls origin"))
+	}))
+	defer originServer.Close()
+
+	client, closeProxy := newProxyTestClient(t)
+	defer closeProxy()
+
+	code, body := proxyTestGet(t, client, originServer.URL+"/tunnel")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "response from tls origin", body)
+}
+
+func TestProxy_ConnectToUnavailableHost_BadGateway(t *testing.T) {
+	req, err := http.NewRequest(http.MethodConnect, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = "127.0.0.1:1"
+
+	httpTestResponseRecorder := httptest.NewRecorder()
+	ProxyConnect(httpTestResponseRecorder, req)
+	assert.Equal(t, http.StatusBadGateway, httpTestResponseRecorder.Code)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// snapshotVersion is version of snapshot format, snapshots of other versions aren't imported
+const snapshotVersion = 1
+
+// Snapshot is full server state: expectations of all namespaces, behaviour for unmatched requests and
+// request journal, which is used by verification to count requests
+type Snapshot struct {
+	Version       int                      `json:"version"`
+	Created       time.Time                `json:"created"`
+	Expectations  []Expectation            `json:"expectations"`
+	Namespaces    map[string][]Expectation `json:"namespaces,omitempty"`
+	Unmatched     Unmatched                `json:"unmatched"`
+	Journal       []JournalEntry           `json:"journal"`
+	JournalLastID int64                    `json:"journallastid"`
+}
+
+// snapshotExpectations returns expectations sorted by key
+func snapshotExpectations(s Store) []Expectation {
+	list, _ := ControllerListExpectations("", nil, 0, 0, s)
+	return list
+}
+
+// SnapshotExport returns current server state
+func SnapshotExport() Snapshot {
+	snapshot := Snapshot{
+		Version:      snapshotVersion,
+		Created:      time.Now().UTC(),
+		Expectations: snapshotExpectations(nil),
+		Unmatched:    UnmatchedGet()}
+	for _, name := range NamespaceList() {
+		if s, ok := NamespaceStore(name); ok {
+			if snapshot.Namespaces == nil {
+				snapshot.Namespaces = map[string][]Expectation{}
+			}
+			snapshot.Namespaces[name] = snapshotExpectations(s)
+		}
+	}
+	snapshot.Journal, snapshot.JournalLastID = JournalExport()
+	return snapshot
+}
+
+// SnapshotFromBytes decodes and validates snapshot. All invalid fields are returned at once, returned error is *APIError
+func SnapshotFromBytes(body []byte) (Snapshot, error) {
+	snapshot := Snapshot{}
+	if apiErr := APIDecodeJSON(bytes.NewReader(body), &snapshot); apiErr != nil {
+		return snapshot, apiErr
+	}
+
+	var raw interface{}
+	json.Unmarshal(body, &raw)
+	fields := ValidateUnknownFields(raw, reflect.TypeOf(snapshot), "")
+	if snapshot.Version != snapshotVersion {
+		fields = append(fields, APIFieldError{Field: "version", Message: fmt.Sprintf("should be %d", snapshotVersion)})
+	}
+	if err := snapshotValidateUnmatched(snapshot.Unmatched); err != nil {
+		fields = append(fields, APIFieldError{Field: "unmatched", Message: err.Error()})
+	}
+	fields = append(fields, snapshotValidateExpectations(snapshot.Expectations, "expectations")...)
+
+	names := make([]string, 0, len(snapshot.Namespaces))
+	for name := range snapshot.Namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := "namespaces." + name
+		if err := NamespaceValidateName(name); err != nil {
+			fields = append(fields, APIFieldError{Field: path, Message: err.Error()})
+		}
+		fields = append(fields, snapshotValidateExpectations(snapshot.Namespaces[name], path)...)
+	}
+	if len(fields) > 0 {
+		return snapshot, APIUnprocessable("snapshot is invalid", fields...)
+	}
+	return snapshot, nil
+}
+
+func snapshotValidateExpectations(exps []Expectation, path string) []APIFieldError {
+	fields := []APIFieldError{}
+	keys := map[string]int{}
+	for i := range exps {
+		if first, ok := keys[exps[i].Key]; ok && exps[i].Key != "" {
+			fields = append(fields, APIFieldError{Field: fmt.Sprintf("%s[%d].key", path, i), Message: fmt.Sprintf("key %s is already used by expectation [%d]", exps[i].Key, first)})
+		} else {
+			keys[exps[i].Key] = i
+		}
+		for _, field := range ExpectationValidate(exps[i]) {
+			field.Field = fmt.Sprintf("%s[%d].%s", path, i, field.Field)
+			fields = append(fields, field)
+		}
+		expectationSetDefaultValues(&exps[i])
+	}
+	return fields
+}
+
+func snapshotValidateUnmatched(u Unmatched) error {
+	switch u.Action {
+	case "", UnmatchedNotImplemented, UnmatchedNotFound, UnmatchedForward:
+		return nil
+	}
+	return fmt.Errorf("unknown action %s for unmatched requests", u.Action)
+}
+
+// SnapshotImport replaces current server state with snapshot. Namespaces which aren't in snapshot are removed.
+// Snapshot should be validated by SnapshotFromBytes. New state is prepared first, so if default store can't
+// save expectations, nothing is changed. Namespaces are replaced at once, requests don't get 404 for namespaces
+// which exist before and after import
+func SnapshotImport(snapshot Snapshot) error {
+	if err := snapshotValidateUnmatched(snapshot.Unmatched); err != nil {
+		return err
+	}
+	stores := map[string]Store{}
+	for name, exps := range snapshot.Namespaces {
+		if err := NamespaceValidateName(name); err != nil {
+			return err
+		}
+		nsStore := NewMemoryStore()
+		nsStore.Put(exps...)
+		stores[name] = nsStore
+	}
+
+	// forward state of previous and replaced expectations is forgotten by controller
+	if _, err := ControllerAddExpectations(snapshot.Expectations, true, nil); err != nil {
+		return err
+	}
+
+	UnmatchedSet(snapshot.Unmatched)
+	NamespaceReplaceAll(stores)
+	JournalRestore(snapshot.Journal, snapshot.JournalLastID)
+	return nil
+}
+
+// SnapshotSave writes current server state to file. File is replaced atomically, so it isn't broken
+// if gozzmock is stopped while writing
+func SnapshotSave(path string) error {
+	body, err := json.MarshalIndent(SnapshotExport(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, body)
+}
+
+// SnapshotLoad restores server state from file
+func SnapshotLoad(path string) error {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	snapshot, err := SnapshotFromBytes(body)
+	if err != nil {
+		return err
+	}
+	return SnapshotImport(snapshot)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func snapshotTestCleanup() {
+	ControllerResetExpectations(nil)
+	for _, name := range NamespaceList() {
+		NamespaceDelete(name)
+	}
+	UnmatchedSet(Unmatched{Action: UnmatchedNotImplemented})
+	JournalReset()
+}
+
+func snapshotTestState(t *testing.T) {
+	ControllerAddExpectation("default", Expectation{Key: "default", Response: &ExpectationResponse{HTTPCode: 200}}, nil)
+	assert.NoError(t, NamespaceCreate("suite1"))
+	nsStore, _ := NamespaceStore("suite1")
+	ControllerAddExpectation("ns", Expectation{Key: "ns", Response: &ExpectationResponse{HTTPCode: 201}}, nsStore)
+	assert.NoError(t, UnmatchedSet(Unmatched{Action: UnmatchedNotFound, Body: "nothing"}))
+	JournalAdd(time.Now(), &ExpectationRequest{Method: "GET", Path: "/default"}, "default", nil, JournalResponse{HTTPCode: 200})
+	JournalAdd(time.Now(), &ExpectationRequest{Method: "GET", Path: "/ns", namespace: "suite1"}, "ns", nil, JournalResponse{HTTPCode: 201})
+}
+
+func TestSnapshotExport_FullState(t *testing.T) {
+	snapshotTestCleanup()
+	defer snapshotTestCleanup()
+	snapshotTestState(t)
+
+	snapshot := SnapshotExport()
+	assert.Equal(t, snapshotVersion, snapshot.Version)
+	assert.Len(t, snapshot.Expectations, 1)
+	assert.Equal(t, "default", snapshot.Expectations[0].Key)
+	assert.Len(t, snapshot.Namespaces["suite1"], 1)
+	assert.Equal(t, UnmatchedNotFound, snapshot.Unmatched.Action)
+	assert.Len(t, snapshot.Journal, 2)
+	assert.Equal(t, "suite1", snapshot.Journal[1].Namespace)
+	assert.Equal(t, snapshot.Journal[1].ID, snapshot.JournalLastID)
+}
+
+func TestSnapshotImport_ReplacesState(t *testing.T) {
+	snapshotTestCleanup()
+	defer snapshotTestCleanup()
+	snapshotTestState(t)
+	snapshot := SnapshotExport()
+
+	snapshotTestCleanup()
+	ControllerAddExpectation("stale", Expectation{Key: "stale"}, nil)
+	assert.NoError(t, NamespaceCreate("stale"))
+
+	assert.NoError(t, SnapshotImport(snapshot))
+	assert.Equal(t, []string{"suite1"}, NamespaceList())
+	_, ok := ControllerGetExpectation("stale", nil)
+	assert.False(t, ok)
+	_, ok = ControllerGetExpectation("default", nil)
+	assert.True(t, ok)
+	nsStore, _ := NamespaceStore("suite1")
+	_, ok = ControllerGetExpectation("ns", nsStore)
+	assert.True(t, ok)
+	assert.Equal(t, "nothing", UnmatchedGet().Body)
+
+	entries := JournalGet(JournalFilter{Namespace: "suite1"})
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "ns", entries[0].Key)
+	entry := JournalAdd(time.Now(), &ExpectationRequest{Method: "GET"}, "", nil, JournalResponse{})
+	assert.Equal(t, snapshot.JournalLastID+1, entry.ID)
+}
+
+func TestSnapshotImport_StoreFails_NothingChanged(t *testing.T) {
+	snapshotTestCleanup()
+	defer snapshotTestCleanup()
+	snapshotTestState(t)
+	snapshot := SnapshotExport()
+	snapshot.Namespaces = map[string][]Expectation{"suite2": {}}
+	snapshot.Unmatched = Unmatched{Action: UnmatchedNotImplemented}
+	snapshot.Journal = nil
+
+	previous := ControllerGetStore(nil)
+	defer ControllerSetStore(previous)
+	ControllerSetStore(failingStore{previous.(*MemoryStore)})
+
+	assert.Error(t, SnapshotImport(snapshot))
+	assert.Equal(t, []string{"suite1"}, NamespaceList())
+	assert.Equal(t, UnmatchedNotFound, UnmatchedGet().Action)
+	assert.Len(t, JournalGet(JournalFilter{}), 1)
+}
+
+func TestSnapshotFromBytes_InvalidFields(t *testing.T) {
+	_, err := SnapshotFromBytes([]byte(`{"version":2,"unmatched":{"action":"teapot"},"expectations":[{"key":"a"},{"key":"a","response":{}}],"namespaces":{"bad name":[]},"extra":1}`))
+	apiErr, ok := err.(*APIError)
+	assert.True(t, ok)
+	fields := map[string]bool{}
+	for _, field := range apiErr.Fields {
+		fields[field.Field] = true
+	}
+	assert.True(t, fields["extra"])
+	assert.True(t, fields["version"])
+	assert.True(t, fields["unmatched"])
+	assert.True(t, fields["expectations[0].response"])
+	assert.True(t, fields["expectations[1].key"])
+	assert.True(t, fields["namespaces.bad name"])
+}
+
+func TestSnapshotSave_Load_File(t *testing.T) {
+	snapshotTestCleanup()
+	defer snapshotTestCleanup()
+	snapshotTestState(t)
+
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	assert.NoError(t, SnapshotSave(path))
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(t, files, 1)
+
+	snapshotTestCleanup()
+	assert.NoError(t, SnapshotLoad(path))
+	assert.Equal(t, []string{"suite1"}, NamespaceList())
+	assert.Len(t, JournalGet(JournalFilter{}), 1)
+
+	assert.Error(t, SnapshotLoad(filepath.Join(dir, "missing.json")))
+}
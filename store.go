@@ -0,0 +1,247 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Types of store events
+const (
+	StoreEventPut    = "put"
+	StoreEventDelete = "delete"
+	// StoreEventOverflow is the last event of watcher which lags behind, events after it are lost
+	StoreEventOverflow = "overflow"
+)
+
+// storeWatchBuffer is number of events which watcher can lag behind, including overflow event
+const storeWatchBuffer = 256
+
+// StoreEvent is change of expectation in store. Expectation is empty for deleted expectations
+type StoreEvent struct {
+	Type        string      `json:"type"`
+	Key         string      `json:"key"`
+	Expectation Expectation `json:"expectation"`
+}
+
+// Store keeps expectations. Every Put and Delete call is applied atomically
+type Store interface {
+	// Get returns expectation with particular key
+	Get(key string) (Expectation, bool)
+	// Put adds expectations or replaces expectations with the same keys
+	Put(exps ...Expectation) error
+	// Delete removes expectations with keys, missing keys are skipped
+	Delete(keys ...string) error
+	// Change puts expectations and removes expectations with keys at once: either all changes are applied or none
+	Change(put []Expectation, keys []string) error
+	// List returns copy of all expectations
+	List() Expectations
+	// Snapshot returns consistent view of all expectations without copying. Snapshot is shared and must not be changed
+	Snapshot() Expectations
+	// Index returns expectations of current snapshot ordered by priority with compiled request filters
+	Index() *ExpectationIndex
+	// Watch returns channel with changes of expectations and function which stops watching. Writers aren't blocked
+	// by slow watcher: if it lags behind by storeWatchBuffer events, it gets overflow event and channel is closed.
+	// To stay in sync, watcher should call Watch again and reload expectations with List
+	Watch() (<-chan StoreEvent, func())
+	// Close releases resources of store
+	Close() error
+}
+
+// MemoryStore keeps expectations in memory, they are lost on restart. Expectations are copied on write:
+// every change creates new state, so readers get consistent snapshot without locking.
+// Request filters are compiled when expectations are put, index is built on the first match after change
+type MemoryStore struct {
+	mu       sync.Mutex
+	state    atomic.Value
+	watchers storeWatchers
+}
+
+// memoryStoreState is immutable state of MemoryStore
+type memoryStoreState struct {
+	exps    Expectations
+	entries map[string]*indexedExpectation
+	once    sync.Once
+	index   *ExpectationIndex
+}
+
+// NewMemoryStore creates empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{}
+	s.state.Store(&memoryStoreState{exps: Expectations{}, entries: map[string]*indexedExpectation{}})
+	return s
+}
+
+func (s *MemoryStore) current() *memoryStoreState {
+	return s.state.Load().(*memoryStoreState)
+}
+
+// next returns copy of current state with capacity for extra expectations
+func (s *MemoryStore) next(extra int) *memoryStoreState {
+	current := s.current()
+	next := &memoryStoreState{exps: current.exps.copy(extra), entries: make(map[string]*indexedExpectation, len(current.entries)+extra)}
+	for key, entry := range current.entries {
+		next.entries[key] = entry
+	}
+	return next
+}
+
+// Get returns expectation with particular key
+func (s *MemoryStore) Get(key string) (Expectation, bool) {
+	exp, ok := s.Snapshot()[key]
+	return exp, ok
+}
+
+// Snapshot returns current expectations. Snapshot is shared and must not be changed
+func (s *MemoryStore) Snapshot() Expectations {
+	return s.current().exps
+}
+
+// Index returns index of current expectations
+func (s *MemoryStore) Index() *ExpectationIndex {
+	state := s.current()
+	state.once.Do(func() {
+		state.index = newExpectationIndex(state.entries)
+	})
+	return state.index
+}
+
+// List returns copy of all expectations
+func (s *MemoryStore) List() Expectations {
+	return s.Snapshot().copy(0)
+}
+
+// Put adds expectations or replaces expectations with the same keys
+func (s *MemoryStore) Put(exps ...Expectation) error {
+	return s.Change(exps, nil)
+}
+
+// Delete removes expectations with keys, missing keys are skipped
+func (s *MemoryStore) Delete(keys ...string) error {
+	return s.Change(nil, keys)
+}
+
+// Change puts expectations, then removes expectations with keys. Requests see either old or new state
+func (s *MemoryStore) Change(put []Expectation, keys []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := s.deleted(put, keys)
+	if len(put) == 0 && len(deleted) == 0 {
+		return nil
+	}
+
+	next := s.next(len(put))
+	for _, exp := range put {
+		next.exps[exp.Key] = exp
+		next.entries[exp.Key] = newIndexedExpectation(exp)
+	}
+	for _, key := range deleted {
+		delete(next.exps, key)
+		delete(next.entries, key)
+	}
+	s.state.Store(next)
+
+	for _, exp := range put {
+		s.watchers.notify(StoreEvent{Type: StoreEventPut, Key: exp.Key, Expectation: exp})
+	}
+	for _, key := range deleted {
+		s.watchers.notify(StoreEvent{Type: StoreEventDelete, Key: key})
+	}
+	return nil
+}
+
+// deleted returns keys which exist after put, missing keys are skipped
+func (s *MemoryStore) deleted(put []Expectation, keys []string) []string {
+	current := s.Snapshot()
+	added := map[string]bool{}
+	for _, exp := range put {
+		added[exp.Key] = true
+	}
+	deleted := []string{}
+	for _, key := range keys {
+		if _, ok := current[key]; ok || added[key] {
+			deleted = append(deleted, key)
+		}
+	}
+	return deleted
+}
+
+// Watch returns channel with changes of expectations and function which stops watching
+func (s *MemoryStore) Watch() (<-chan StoreEvent, func()) {
+	return s.watchers.add()
+}
+
+// Close stops all watchers
+func (s *MemoryStore) Close() error {
+	s.watchers.close()
+	return nil
+}
+
+// copy returns copy of expectations with capacity for extra expectations
+func (exps Expectations) copy(extra int) Expectations {
+	copied := make(Expectations, len(exps)+extra)
+	for key, exp := range exps {
+		copied[key] = exp
+	}
+	return copied
+}
+
+// storeWatchers delivers store events to watchers. Events aren't blocked by slow watchers, slow watcher gets
+// overflow event in the last free place of its channel and is stopped
+type storeWatchers struct {
+	mu       sync.Mutex
+	lastID   int
+	channels map[int]chan StoreEvent
+}
+
+func (w *storeWatchers) add() (<-chan StoreEvent, func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.channels == nil {
+		w.channels = map[int]chan StoreEvent{}
+	}
+	w.lastID++
+	id := w.lastID
+	events := make(chan StoreEvent, storeWatchBuffer)
+	w.channels[id] = events
+
+	return events, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		if events, ok := w.channels[id]; ok {
+			delete(w.channels, id)
+			close(events)
+		}
+	}
+}
+
+func (w *storeWatchers) notify(event StoreEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for id, events := range w.channels {
+		// only notify sends to channel and it's serialized by mutex, so there is a free place
+		if len(events) < cap(events)-1 {
+			events <- event
+			continue
+		}
+		log.Warn().Str("function", "storeWatchers.notify").Msgf("Watcher is too slow, it's stopped on %s event of %s", event.Type, event.Key)
+		events <- StoreEvent{Type: StoreEventOverflow}
+		delete(w.channels, id)
+		close(events)
+	}
+}
+
+func (w *storeWatchers) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for id, events := range w.channels {
+		delete(w.channels, id)
+		close(events)
+	}
+}
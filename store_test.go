@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStore(exps ...Expectation) *MemoryStore {
+	s := NewMemoryStore()
+	s.Put(exps...)
+	return s
+}
+
+// failingStore fails all changes
+type failingStore struct {
+	*MemoryStore
+}
+
+func (s failingStore) Put(exps ...Expectation) error {
+	return errors.New("disk is full")
+}
+
+func (s failingStore) Delete(keys ...string) error {
+	return errors.New("disk is full")
+}
+
+func (s failingStore) Change(put []Expectation, keys []string) error {
+	return errors.New("disk is full")
+}
+
+func TestMemoryStore_PutGetDeleteList(t *testing.T) {
+	s := NewMemoryStore()
+	assert.NoError(t, s.Put(Expectation{Key: "a"}, Expectation{Key: "b", Delay: 1}))
+
+	exp, ok := s.Get("b")
+	assert.True(t, ok)
+	assert.Equal(t, Expectation{Key: "b", Delay: 1}, exp)
+
+	list := s.List()
+	assert.Len(t, list, 2)
+	delete(list, "a")
+	assert.Len(t, s.List(), 2)
+
+	assert.NoError(t, s.Delete("a", "missing"))
+	_, ok = s.Get("a")
+	assert.False(t, ok)
+	assert.Len(t, s.List(), 1)
+}
+
+func TestMemoryStore_Watch_EventsUntilStopped(t *testing.T) {
+	s := NewMemoryStore()
+	events, stop := s.Watch()
+
+	s.Put(Expectation{Key: "a"})
+	s.Delete("a", "missing")
+	assert.Equal(t, StoreEvent{Type: StoreEventPut, Key: "a", Expectation: Expectation{Key: "a"}}, <-events)
+	assert.Equal(t, StoreEvent{Type: StoreEventDelete, Key: "a"}, <-events)
+
+	stop()
+	stop()
+	s.Put(Expectation{Key: "b"})
+	_, open := <-events
+	assert.False(t, open)
+}
+
+func TestMemoryStore_Watch_SlowWatcherOverflowAndResync(t *testing.T) {
+	s := NewMemoryStore()
+	events, stop := s.Watch()
+	defer stop()
+
+	for i := 0; i < storeWatchBuffer+10; i++ {
+		s.Put(Expectation{Key: fmt.Sprintf("a%d", i)})
+	}
+	received := []StoreEvent{}
+	for event := range events {
+		received = append(received, event)
+	}
+	assert.Len(t, received, storeWatchBuffer)
+	assert.Equal(t, StoreEvent{Type: StoreEventPut, Key: "a0", Expectation: Expectation{Key: "a0"}}, received[0])
+	assert.Equal(t, StoreEvent{Type: StoreEventOverflow}, received[storeWatchBuffer-1])
+
+	// watcher watches again and reloads expectations, so later changes aren't missed
+	events, stop = s.Watch()
+	defer stop()
+	assert.Len(t, s.List(), storeWatchBuffer+10)
+	s.Delete("a0")
+	assert.Equal(t, StoreEvent{Type: StoreEventDelete, Key: "a0"}, <-events)
+}
+
+func TestMemoryStore_Close_StopsWatchers(t *testing.T) {
+	s := NewMemoryStore()
+	events, stop := s.Watch()
+
+	assert.NoError(t, s.Close())
+	_, open := <-events
+	assert.False(t, open)
+	stop()
+}
+
+func TestMemoryStore_Snapshot_NotChangedByLaterChanges(t *testing.T) {
+	s := newTestStore(Expectation{Key: "a"})
+	snapshot := s.Snapshot()
+
+	s.Put(Expectation{Key: "b"})
+	s.Delete("a")
+	assert.Equal(t, Expectations{"a": Expectation{Key: "a"}}, snapshot)
+	assert.Equal(t, Expectations{"b": Expectation{Key: "b"}}, s.Snapshot())
+}
+
+func TestMemoryStore_Change_PutAndDeleteAtOnce(t *testing.T) {
+	s := newTestStore(Expectation{Key: "a"}, Expectation{Key: "b"})
+	snapshot := s.Snapshot()
+	events, stop := s.Watch()
+	defer stop()
+
+	assert.NoError(t, s.Change([]Expectation{{Key: "c"}}, []string{"a", "missing"}))
+	assert.Equal(t, Expectations{"a": Expectation{Key: "a"}, "b": Expectation{Key: "b"}}, snapshot)
+	assert.Equal(t, Expectations{"b": Expectation{Key: "b"}, "c": Expectation{Key: "c"}}, s.Snapshot())
+	assert.Equal(t, StoreEvent{Type: StoreEventPut, Key: "c", Expectation: Expectation{Key: "c"}}, <-events)
+	assert.Equal(t, StoreEvent{Type: StoreEventDelete, Key: "a"}, <-events)
+	assert.Len(t, events, 0)
+}
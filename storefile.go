@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	storeFileSnapshotName = "expectations.json"
+	storeFileWALName      = "expectations.wal"
+	// storeFileDefaultCompactRecords is number of records in write-ahead log after which it's compacted into snapshot
+	storeFileDefaultCompactRecords = 1000
+)
+
+// storeFileRecord is one line of write-ahead log, all its changes are applied at once
+type storeFileRecord struct {
+	Put    []Expectation `json:"put,omitempty"`
+	Delete []string      `json:"delete,omitempty"`
+}
+
+// FileStore keeps expectations in memory and persists them to directory, so they survive restarts.
+// Every change is appended to write-ahead log and synced before it's applied. When log grows, expectations are
+// written to snapshot file and log is truncated. On open, snapshot is loaded and log is replayed, torn record
+// at the end of log left by crash is dropped
+type FileStore struct {
+	dir            string
+	compactRecords int
+	mu             sync.Mutex
+	wal            *os.File
+	size           int64
+	records        int
+	memory         *MemoryStore
+}
+
+// NewFileStore opens store in directory, directory is created if it doesn't exist.
+// compactRecords is number of log records after which log is compacted into snapshot
+func NewFileStore(dir string, compactRecords int) (*FileStore, error) {
+	if compactRecords <= 0 {
+		compactRecords = storeFileDefaultCompactRecords
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &FileStore{dir: dir, compactRecords: compactRecords, memory: NewMemoryStore()}
+	if err := s.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := s.replayWAL(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) loadSnapshot() error {
+	body, err := ioutil.ReadFile(filepath.Join(s.dir, storeFileSnapshotName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	exps := []Expectation{}
+	if err = json.Unmarshal(body, &exps); err != nil {
+		return err
+	}
+	return s.memory.Put(exps...)
+}
+
+func (s *FileStore) replayWAL() error {
+	fLog := log.With().Str("function", "FileStore.replayWAL").Logger()
+
+	wal, err := os.OpenFile(filepath.Join(s.dir, storeFileWALName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(wal)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+		record := storeFileRecord{}
+		if err != nil || json.Unmarshal(line, &record) != nil {
+			fLog.Warn().Int64("offset", s.size).Msg("Torn record at the end of write-ahead log is dropped")
+			break
+		}
+		s.apply(record)
+		s.size += int64(len(line))
+		s.records++
+	}
+
+	if err = wal.Truncate(s.size); err == nil {
+		_, err = wal.Seek(s.size, io.SeekStart)
+	}
+	// newly created log should survive power loss too
+	if err == nil {
+		err = syncDir(s.dir)
+	}
+	if err != nil {
+		wal.Close()
+		return err
+	}
+	s.wal = wal
+	return nil
+}
+
+func (s *FileStore) apply(record storeFileRecord) {
+	s.memory.Change(record.Put, record.Delete)
+}
+
+// write appends record to log and applies it. If write fails, log is truncated back and nothing is applied.
+// Missing keys are removed from record, empty record isn't written
+func (s *FileStore) write(record storeFileRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record.Delete = s.memory.deleted(record.Put, record.Delete)
+	if len(record.Put) == 0 && len(record.Delete) == 0 {
+		return nil
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if _, err = s.wal.Write(line); err == nil {
+		err = s.wal.Sync()
+	}
+	if err != nil {
+		s.wal.Truncate(s.size)
+		s.wal.Seek(s.size, io.SeekStart)
+		return err
+	}
+	s.size += int64(len(line))
+	s.records++
+	s.apply(record)
+
+	if s.records >= s.compactRecords {
+		if err := s.compact(); err != nil {
+			log.Error().Str("function", "FileStore.write").Err(err).Msg("Can't compact write-ahead log")
+		}
+	}
+	return nil
+}
+
+// compact writes all expectations to snapshot and truncates log. Log is truncated only after rename of snapshot
+// is synced to disk. If gozzmock stops between these steps, log is replayed over new snapshot, which gives the same expectations
+func (s *FileStore) compact() error {
+	exps := []Expectation{}
+	for _, exp := range s.memory.Snapshot() {
+		exps = append(exps, exp)
+	}
+	body, err := json.Marshal(exps)
+	if err != nil {
+		return err
+	}
+	if err = writeFileAtomic(filepath.Join(s.dir, storeFileSnapshotName), body); err != nil {
+		return err
+	}
+	if err = s.wal.Truncate(0); err != nil {
+		return err
+	}
+	if _, err = s.wal.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	s.size = 0
+	s.records = 0
+	return nil
+}
+
+// Get returns expectation with particular key
+func (s *FileStore) Get(key string) (Expectation, bool) {
+	return s.memory.Get(key)
+}
+
+// Put persists and adds expectations or replaces expectations with the same keys
+func (s *FileStore) Put(exps ...Expectation) error {
+	return s.Change(exps, nil)
+}
+
+// Delete persists removal of expectations with keys, missing keys are skipped
+func (s *FileStore) Delete(keys ...string) error {
+	return s.Change(nil, keys)
+}
+
+// Change persists puts and removals as one log record, so they are applied together after crash too
+func (s *FileStore) Change(put []Expectation, keys []string) error {
+	return s.write(storeFileRecord{Put: put, Delete: keys})
+}
+
+// List returns copy of all expectations
+func (s *FileStore) List() Expectations {
+	return s.memory.List()
+}
+
+// Snapshot returns current expectations. Snapshot is shared and must not be changed
+func (s *FileStore) Snapshot() Expectations {
+	return s.memory.Snapshot()
+}
+
+// Index returns index of current expectations
+func (s *FileStore) Index() *ExpectationIndex {
+	return s.memory.Index()
+}
+
+// Watch returns channel with changes of expectations and function which stops watching
+func (s *FileStore) Watch() (<-chan StoreEvent, func()) {
+	return s.memory.Watch()
+}
+
+// Close compacts log into snapshot and closes files
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.compact()
+	if closeErr := s.wal.Close(); err == nil {
+		err = closeErr
+	}
+	s.memory.Close()
+	return err
+}
+
+// writeFileAtomic writes file through temporary file and rename, so file isn't broken
+// if gozzmock is stopped while writing. Directory is synced, so rename survives power loss
+func writeFileAtomic(path string, body []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(body); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir flushes directory entries, like created or renamed files, to disk
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func openTestFileStore(t *testing.T, dir string, compactRecords int) *FileStore {
+	s, err := NewFileStore(dir, compactRecords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func readWALLines(t *testing.T, dir string) []string {
+	body, err := ioutil.ReadFile(filepath.Join(dir, storeFileWALName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(body) == 0 {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+}
+
+func TestFileStore_Reopen_ChangesReplayedFromWAL(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+
+	s := openTestFileStore(t, dir, 0)
+	assert.NoError(t, s.Put(Expectation{Key: "a", Response: &ExpectationResponse{HTTPCode: 200}}, Expectation{Key: "b"}))
+	assert.NoError(t, s.Delete("b", "missing"))
+	assert.NoError(t, s.Put(Expectation{Key: "c", Labels: map[string]string{"suite": "x"}}))
+	assert.Len(t, readWALLines(t, dir), 3)
+	// no Close, like after crash
+
+	reopened := openTestFileStore(t, dir, 0)
+	defer reopened.Close()
+	assert.Equal(t, s.List(), reopened.List())
+	exp, ok := reopened.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 200, exp.Response.HTTPCode)
+}
+
+func TestFileStore_TornRecord_Dropped(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+
+	s := openTestFileStore(t, dir, 0)
+	assert.NoError(t, s.Put(Expectation{Key: "a"}))
+	wal, err := os.OpenFile(filepath.Join(dir, storeFileWALName), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wal.Write([]byte(`{"put":[{"key":"torn"`))
+	wal.Close()
+
+	reopened := openTestFileStore(t, dir, 0)
+	assert.Len(t, reopened.List(), 1)
+	assert.Len(t, readWALLines(t, dir), 1)
+
+	assert.NoError(t, reopened.Put(Expectation{Key: "b"}))
+	assert.NoError(t, reopened.Close())
+	assert.Len(t, openTestFileStore(t, dir, 0).List(), 2)
+}
+
+func TestFileStore_Compact_SnapshotAndEmptyWAL(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+
+	s := openTestFileStore(t, dir, 3)
+	s.Put(Expectation{Key: "a"})
+	s.Put(Expectation{Key: "b"})
+	s.Delete("a")
+	assert.Empty(t, readWALLines(t, dir))
+	_, err := os.Stat(filepath.Join(dir, storeFileSnapshotName))
+	assert.NoError(t, err)
+
+	s.Put(Expectation{Key: "c"})
+	assert.Len(t, readWALLines(t, dir), 1)
+
+	reopened := openTestFileStore(t, dir, 3)
+	defer reopened.Close()
+	assert.Equal(t, Expectations{"b": Expectation{Key: "b"}, "c": Expectation{Key: "c"}}, reopened.List())
+}
+
+func TestFileStore_Close_CompactsWAL(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+
+	s := openTestFileStore(t, dir, 0)
+	s.Put(Expectation{Key: "a"})
+	assert.NoError(t, s.Close())
+	assert.Empty(t, readWALLines(t, dir))
+	assert.Len(t, openTestFileStore(t, dir, 0).List(), 1)
+}
+
+func TestFileStore_Watch_Events(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+
+	s := openTestFileStore(t, dir, 0)
+	defer s.Close()
+	events, stop := s.Watch()
+	defer stop()
+
+	s.Put(Expectation{Key: "a"})
+	assert.Equal(t, "a", (<-events).Key)
+}
+
+func TestFileStore_InvalidSnapshot_Error(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, storeFileSnapshotName), []byte("{"), 0644)
+	_, err := NewFileStore(dir, 0)
+	assert.Error(t, err)
+}
+
+func TestControllerSetStore_FileStoreUsedByHandlers(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	previous := ControllerGetStore(nil)
+	defer ControllerSetStore(previous)
+
+	s := openTestFileStore(t, dir, 0)
+	ControllerSetStore(s)
+	_, err := ControllerAddExpectation("durable", Expectation{Response: &ExpectationResponse{HTTPCode: 200}}, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Close())
+
+	ControllerSetStore(openTestFileStore(t, dir, 0))
+	exp, ok := ControllerGetExpectation("durable", nil)
+	assert.True(t, ok)
+	assert.Equal(t, "durable", exp.Key)
+}
+
+func TestFileStore_Change_OneRecord(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+
+	s := openTestFileStore(t, dir, 0)
+	assert.NoError(t, s.Put(Expectation{Key: "a"}, Expectation{Key: "b"}))
+	_, err := ControllerAddExpectations([]Expectation{{Key: "c"}}, true, s)
+	assert.NoError(t, err)
+	assert.Len(t, readWALLines(t, dir), 2)
+	assert.Equal(t, `{"put":[{"key":"c"}],"delete":["a","b"]}`, readWALLines(t, dir)[1])
+
+	reopened := openTestFileStore(t, dir, 0)
+	defer reopened.Close()
+	assert.Equal(t, Expectations{"c": Expectation{Key: "c"}}, reopened.List())
+}
+
+func TestWriteFileAtomic_ReplacesFile(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.json")
+	assert.NoError(t, writeFileAtomic(path, []byte("old")))
+	assert.NoError(t, writeFileAtomic(path, []byte("new")))
+	body, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "new", string(body))
+	infos, _ := ioutil.ReadDir(dir)
+	assert.Len(t, infos, 1)
+}
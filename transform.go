@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// TransformModifiesBody returns true if transform changes response body.
+// Such transforms require decoded body
+func TransformModifiesBody(transform *ExpectationTransform) bool {
+	if transform == nil {
+		return false
+	}
+	return len(transform.MergePatch) > 0 || len(transform.Set) > 0 || len(transform.Replace) > 0
+}
+
+// TransformJSONMergePatch applies RFC 7386 JSON merge patch to JSON document
+func TransformJSONMergePatch(doc []byte, patch []byte) ([]byte, error) {
+	var docValue interface{}
+	if len(bytes.TrimSpace(doc)) > 0 {
+		if err := unmarshalJSON(doc, &docValue); err != nil {
+			return nil, err
+		}
+	}
+
+	var patchValue interface{}
+	if err := unmarshalJSON(patch, &patchValue); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(mergePatch(docValue, patchValue))
+}
+
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+	return targetObject
+}
+
+// TransformJSONPathSet sets value to the element of JSON document selected by path.
+// Supported path syntax is a subset of JSONPath: $.field, $['field'], $.array[0].
+// Missing object fields are created, array index must exist or be equal to array length to append
+func TransformJSONPathSet(doc []byte, path string, value json.RawMessage) ([]byte, error) {
+	segments, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var docValue interface{}
+	if len(bytes.TrimSpace(doc)) > 0 {
+		if err := unmarshalJSON(doc, &docValue); err != nil {
+			return nil, err
+		}
+	}
+
+	var newValue interface{}
+	if err := unmarshalJSON(value, &newValue); err != nil {
+		return nil, err
+	}
+
+	result, err := setJSONPath(docValue, segments, newValue)
+	if err != nil {
+		return nil, fmt.Errorf("path %s: %s", path, err)
+	}
+	return json.Marshal(result)
+}
+
+// jsonPathSegment is either object field name or array index
+type jsonPathSegment struct {
+	Field   string
+	Index   int
+	IsIndex bool
+}
+
+func parseJSONPath(path string) ([]jsonPathSegment, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("JSONPath %s should start with $", path)
+	}
+
+	segments := []jsonPathSegment{}
+	rest := path[1:]
+	for len(rest) > 0 {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			field := rest[1 : end+1]
+			if field == "" {
+				return nil, fmt.Errorf("JSONPath %s has empty field name", path)
+			}
+			segments = append(segments, jsonPathSegment{Field: field})
+			rest = rest[end+1:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("JSONPath %s has unclosed bracket", path)
+			}
+			selector := rest[1:end]
+			if len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0] {
+				segments = append(segments, jsonPathSegment{Field: selector[1 : len(selector)-1]})
+			} else {
+				index, err := strconv.Atoi(selector)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("JSONPath %s has invalid index %s", path, selector)
+				}
+				segments = append(segments, jsonPathSegment{Index: index, IsIndex: true})
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("JSONPath %s has unexpected character %q", path, rest[0])
+		}
+	}
+	return segments, nil
+}
+
+func setJSONPath(node interface{}, segments []jsonPathSegment, value interface{}) (interface{}, error) {
+	if len(segments) == 0 {
+		return value, nil
+	}
+
+	segment := segments[0]
+	if segment.IsIndex {
+		array, ok := node.([]interface{})
+		if !ok && node != nil {
+			return nil, fmt.Errorf("element is not an array")
+		}
+		if segment.Index > len(array) {
+			return nil, fmt.Errorf("index %d is out of range", segment.Index)
+		}
+		if segment.Index == len(array) {
+			array = append(array, nil)
+		}
+		child, err := setJSONPath(array[segment.Index], segments[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		array[segment.Index] = child
+		return array, nil
+	}
+
+	object, ok := node.(map[string]interface{})
+	if !ok {
+		if node != nil {
+			return nil, fmt.Errorf("element is not an object")
+		}
+		object = map[string]interface{}{}
+	}
+	child, err := setJSONPath(object[segment.Field], segments[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	object[segment.Field] = child
+	return object, nil
+}
+
+// unmarshalJSON keeps numbers as is to avoid precision loss
+func unmarshalJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// TransformRegexReplace replaces all matches of regex in body
+func TransformRegexReplace(body []byte, regex string, replacement string) ([]byte, error) {
+	r, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, err
+	}
+	return r.ReplaceAll(body, []byte(replacement)), nil
+}
+
+// transformUpstreamResponse applies transform rules to response from forward target.
+// Rules which can't be applied are skipped
+func transformUpstreamResponse(resp *upstreamResponse, transform *ExpectationTransform) {
+	fLog := log.With().Str("function", "transformUpstreamResponse").Logger()
+
+	if transform == nil {
+		return
+	}
+
+	if transform.HTTPCode > 0 {
+		resp.StatusCode = transform.HTTPCode
+	}
+
+	for _, name := range transform.RemoveHeaders {
+		resp.Header.Del(name)
+	}
+	if transform.Headers != nil {
+		for name, value := range *transform.Headers {
+			resp.Header.Set(name, value)
+		}
+	}
+
+	if len(transform.MergePatch) > 0 {
+		body, err := TransformJSONMergePatch(resp.Body, transform.MergePatch)
+		if err != nil {
+			fLog.Error().Err(err).Msg("Can't apply merge patch to response body")
+		} else {
+			resp.Body = body
+		}
+	}
+
+	for _, set := range transform.Set {
+		body, err := TransformJSONPathSet(resp.Body, set.Path, set.Value)
+		if err != nil {
+			fLog.Error().Err(err).Msgf("Can't set %s in response body", set.Path)
+			continue
+		}
+		resp.Body = body
+	}
+
+	for _, replace := range transform.Replace {
+		body, err := TransformRegexReplace(resp.Body, replace.Regex, replace.Replacement)
+		if err != nil {
+			fLog.Error().Err(err).Msgf("Can't replace %s in response body", replace.Regex)
+			continue
+		}
+		resp.Body = body
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransformJSONMergePatch_AddReplaceRemove_OK(t *testing.T) {
+	doc := []byte(`{"a":1,"b":{"c":2,"d":3},"e":4}`)
+	patch := []byte(`{"a":10,"b":{"c":null,"f":5},"e":null}`)
+	result, err := TransformJSONMergePatch(doc, patch)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"a":10,"b":{"d":3,"f":5}}`, string(result))
+}
+
+func TestTransformJSONMergePatch_NotObjectPatch_Replaced(t *testing.T) {
+	result, err := TransformJSONMergePatch([]byte(`{"a":1}`), []byte(`[1,2]`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[1,2]`, string(result))
+}
+
+func TestTransformJSONMergePatch_InvalidDoc_Error(t *testing.T) {
+	_, err := TransformJSONMergePatch([]byte(`not json`), []byte(`{"a":1}`))
+	assert.Error(t, err)
+}
+
+func TestTransformJSONMergePatch_BigNumber_Preserved(t *testing.T) {
+	result, err := TransformJSONMergePatch([]byte(`{"id":12345678901234567890}`), []byte(`{"a":1}`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id":12345678901234567890,"a":1}`, string(result))
+}
+
+func TestTransformJSONPathSet_NestedField_OK(t *testing.T) {
+	result, err := TransformJSONPathSet([]byte(`{"a":{"b":[{"c":1},{"c":2}]}}`), "$.a.b[1].c", json.RawMessage(`"x"`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"a":{"b":[{"c":1},{"c":"x"}]}}`, string(result))
+}
+
+func TestTransformJSONPathSet_MissingFields_Created(t *testing.T) {
+	result, err := TransformJSONPathSet([]byte(`{}`), "$['a'].b", json.RawMessage(`{"c":true}`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"a":{"b":{"c":true}}}`, string(result))
+}
+
+func TestTransformJSONPathSet_AppendToArray_OK(t *testing.T) {
+	result, err := TransformJSONPathSet([]byte(`[1]`), "$[1]", json.RawMessage(`2`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[1,2]`, string(result))
+}
+
+func TestTransformJSONPathSet_IndexOutOfRange_Error(t *testing.T) {
+	_, err := TransformJSONPathSet([]byte(`[1]`), "$[5]", json.RawMessage(`2`))
+	assert.Error(t, err)
+}
+
+func TestTransformJSONPathSet_InvalidPath_Error(t *testing.T) {
+	_, err := TransformJSONPathSet([]byte(`{}`), "a.b", json.RawMessage(`2`))
+	assert.Error(t, err)
+	_, err = TransformJSONPathSet([]byte(`{}`), "$.a[x]", json.RawMessage(`2`))
+	assert.Error(t, err)
+	_, err = TransformJSONPathSet([]byte(`{}`), "$.a[0", json.RawMessage(`2`))
+	assert.Error(t, err)
+}
+
+func TestTransformRegexReplace_Groups_OK(t *testing.T) {
+	result, err := TransformRegexReplace([]byte("id=1, id=2"), `id=(\d)`, "num=$1")
+	assert.NoError(t, err)
+	assert.Equal(t, "num=1, num=2", string(result))
+}
+
+func TestTransformRegexReplace_InvalidRegex_Error(t *testing.T) {
+	_, err := TransformRegexReplace([]byte("abc"), "(", "")
+	assert.Error(t, err)
+}
+
+func TestTransformUpstreamResponse_AllRules_Applied(t *testing.T) {
+	resp := &upstreamResponse{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"X-Remove": {"v"}, "X-Keep": {"v"}},
+		Body:       []byte(`{"status":"ok","items":[{"name":"a"}]}`)}
+	transform := &ExpectationTransform{
+		HTTPCode:      http.StatusTeapot,
+		Headers:       &Headers{"X-Add": "added"},
+		RemoveHeaders: []string{"X-Remove"},
+		MergePatch:    json.RawMessage(`{"status":"edge"}`),
+		Set:           []ExpectationJSONPathSet{{Path: "$.items[0].name", Value: json.RawMessage(`"b"`)}},
+		Replace:       []ExpectationReplace{{Regex: "edge", Replacement: "edge-case"}}}
+
+	transformUpstreamResponse(resp, transform)
+	assert.Equal(t, http.StatusTeapot, resp.StatusCode)
+	assert.Equal(t, "added", resp.Header.Get("X-Add"))
+	assert.Equal(t, "v", resp.Header.Get("X-Keep"))
+	assert.Empty(t, resp.Header.Get("X-Remove"))
+	assert.JSONEq(t, `{"status":"edge-case","items":[{"name":"b"}]}`, string(resp.Body))
+}
+
+func TestTransformUpstreamResponse_NotJSONBody_Skipped(t *testing.T) {
+	resp := &upstreamResponse{StatusCode: http.StatusOK, Header: http.Header{}, Body: []byte("plain text")}
+	transformUpstreamResponse(resp, &ExpectationTransform{
+		MergePatch: json.RawMessage(`{"a":1}`),
+		Replace:    []ExpectationReplace{{Regex: "plain", Replacement: "rich"}}})
+	assert.Equal(t, "rich text", string(resp.Body))
+}
+
+func TestTransformModifiesBody(t *testing.T) {
+	assert.False(t, TransformModifiesBody(nil))
+	assert.False(t, TransformModifiesBody(&ExpectationTransform{HTTPCode: http.StatusOK}))
+	assert.True(t, TransformModifiesBody(&ExpectationTransform{Replace: []ExpectationReplace{{Regex: "a"}}}))
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Actions for requests which don't pass any expectation filter
+const (
+	UnmatchedNotImplemented = "notimplemented"
+	UnmatchedNotFound       = "notfound"
+	UnmatchedForward        = "forward"
+)
+
+// unmatchedDefaultBody is response body for unmatched requests if other body isn't configured
+const unmatchedDefaultBody = "No expectations in gozzmock for request!"
+
+// unmatchedStateName is name of forward state of unmatched requests
+const unmatchedStateName = "unmatched"
+
+// unmatchedVia marks requests forwarded by gozzmock to detect forwarding loops
+const unmatchedVia = "1.1 gozzmock"
+
+// Unmatched is server behaviour for requests which don't pass any expectation filter
+type Unmatched struct {
+	Action string            `json:"action"`
+	Body   string            `json:"body,omitempty"`
+	Scheme string            `json:"scheme,omitempty"`
+	Hosts  map[string]string `json:"hosts,omitempty"`
+}
+
+var unmatched = Unmatched{Action: UnmatchedNotImplemented}
+
+var unmatchedMu sync.Mutex
+
+// UnmatchedGet returns current behaviour for unmatched requests
+func UnmatchedGet() Unmatched {
+	unmatchedMu.Lock()
+	defer unmatchedMu.Unlock()
+
+	return unmatched
+}
+
+// UnmatchedSet validates and sets behaviour for unmatched requests
+func UnmatchedSet(u Unmatched) error {
+	switch u.Action {
+	case "":
+		u.Action = UnmatchedNotImplemented
+	case UnmatchedNotImplemented, UnmatchedNotFound, UnmatchedForward:
+	default:
+		return fmt.Errorf("unknown action %s for unmatched requests", u.Action)
+	}
+	if u.Action == UnmatchedForward && u.Scheme == "" {
+		u.Scheme = "http"
+	}
+
+	unmatchedMu.Lock()
+	defer unmatchedMu.Unlock()
+
+	unmatched = u
+	return nil
+}
+
+// UnmatchedOrigin returns origin host for incoming host. Incoming host is origin if there is no mapping for it
+func UnmatchedOrigin(u Unmatched, host string) string {
+	if origin, ok := u.Hosts[host]; ok {
+		return origin
+	}
+	if origin, ok := u.Hosts[strings.Split(host, ":")[0]]; ok {
+		return origin
+	}
+	return host
+}
+
+// uploadUnmatchedResponse writes response for request which doesn't pass any expectation filter
+func uploadUnmatchedResponse(w http.ResponseWriter, req *ExpectationRequest) {
+	fLog := log.With().Str("function", "uploadUnmatchedResponse").Logger()
+
+	u := UnmatchedGet()
+	body := u.Body
+	if body == "" {
+		body = unmatchedDefaultBody
+	}
+
+	if req.proxied || u.Action == UnmatchedForward {
+		if req.Headers != nil && strings.Contains((*req.Headers)["Via"], unmatchedVia) {
+			fLog.Error().Msgf("Request to %s has been forwarded by gozzmock already", req.URL)
+			w.WriteHeader(http.StatusLoopDetected)
+			w.Write([]byte("Forwarding loop detected by gozzmock"))
+			return
+		}
+	}
+
+	if req.proxied {
+		proxyToOriginalDestination(w, req)
+		return
+	}
+
+	switch u.Action {
+	case UnmatchedNotFound:
+		fLog.Error().Msg("No expectations in gozzmock for request!")
+		writeUnmatchedBody(w, req, http.StatusNotFound, body)
+		return
+	case UnmatchedForward:
+		origin := UnmatchedOrigin(u, req.Host)
+		if origin == "" {
+			break
+		}
+		fLog.Info().Msgf("No expectations for request, forward to %s", origin)
+		fwd := &ExpectationForward{Scheme: u.Scheme, Host: origin, Headers: &Headers{"Via": unmatchedVia}}
+		doHTTPRequest(w, namespaceInternalStateKey(req.namespace, unmatchedStateName), unmatchedStateName, req, fwd)
+		return
+	}
+
+	fLog.Error().Msg("No expectations in gozzmock for request!")
+	writeUnmatchedBody(w, req, http.StatusNotImplemented, body)
+}
+
+// writeUnmatchedBody writes body for unmatched request. If request asks for explanation, body is replaced with the closest expectations
+func writeUnmatchedBody(w http.ResponseWriter, req *ExpectationRequest, statusCode int, body string) {
+	if !explainRequested(req) {
+		w.WriteHeader(statusCode)
+		w.Write([]byte(body))
+		return
+	}
+
+	explanation := Explain(req)
+	explanation.Message = body
+	explanationjson, err := json.Marshal(explanation)
+	if err != nil {
+		apiWriteError(w, APIInternal("can't encode response: "+err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(explanationjson)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmatchedSet_UnknownAction_Error(t *testing.T) {
+	defer UnmatchedSet(Unmatched{})
+
+	assert.Error(t, UnmatchedSet(Unmatched{Action: "wrong"}))
+	assert.Equal(t, UnmatchedNotImplemented, UnmatchedGet().Action)
+}
+
+func TestUnmatchedSet_ForwardWithoutScheme_DefaultScheme(t *testing.T) {
+	defer UnmatchedSet(Unmatched{})
+
+	assert.NoError(t, UnmatchedSet(Unmatched{Action: UnmatchedForward}))
+	assert.Equal(t, UnmatchedForward, UnmatchedGet().Action)
+	assert.Equal(t, "http", UnmatchedGet().Scheme)
+}
+
+func TestUnmatchedSet_EmptyAction_NotImplemented(t *testing.T) {
+	assert.NoError(t, UnmatchedSet(Unmatched{Body: "b"}))
+	assert.Equal(t, UnmatchedNotImplemented, UnmatchedGet().Action)
+	assert.NoError(t, UnmatchedSet(Unmatched{}))
+}
+
+func TestUnmatchedOrigin_HostMapping_OK(t *testing.T) {
+	u := Unmatched{Hosts: map[string]string{"api.local": "api.github.com", "a:8080": "b"}}
+	assert.Equal(t, "api.github.com", UnmatchedOrigin(u, "api.local"))
+	assert.Equal(t, "api.github.com", UnmatchedOrigin(u, "api.local:8080"))
+	assert.Equal(t, "b", UnmatchedOrigin(u, "a:8080"))
+	assert.Equal(t, "other.com", UnmatchedOrigin(u, "other.com"))
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// ExpectationValidate returns list of invalid fields of expectation: missing key, missing or conflicting actions,
+// invalid regexes, HTTP codes and JSONPaths
+func ExpectationValidate(exp Expectation) []APIFieldError {
+	fields := []APIFieldError{}
+	addError := func(field string, format string, args ...interface{}) {
+		fields = append(fields, APIFieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if exp.Key == "" {
+		addError("key", "key is required")
+	}
+	if strings.Contains(exp.Key, namespaceStateSeparator) {
+		addError("key", "key can't contain NUL character")
+	}
+	if exp.Response != nil && exp.Forward != nil {
+		addError("forward", "only one of response or forward can be set")
+	}
+	if exp.Response == nil && exp.Forward == nil {
+		addError("response", "one of response or forward is required")
+	}
+	if exp.Delay < 0 {
+		addError("delay", "delay can't be negative")
+	}
+
+	for _, name := range sortedLabelNames(exp.Labels) {
+		if !labelNameRegexp.MatchString(name) {
+			addError("labels."+name, "label name should be non-empty and contain only letters, digits, ., _, / and -")
+		}
+		if !labelValueRegexp.MatchString(exp.Labels[name]) {
+			addError("labels."+name, "label value should contain only letters, digits, ., _, / and -")
+		}
+	}
+
+	if exp.Request != nil {
+		for _, f := range []struct{ field, filter string }{
+			{"request.host", exp.Request.Host},
+			{"request.url", exp.Request.URL},
+			{"request.path", exp.Request.Path},
+			{"request.body", exp.Request.Body},
+		} {
+			validateRegex(&fields, f.field, f.filter)
+		}
+		if exp.Request.Headers != nil {
+			for _, name := range sortedHeaderNames(exp.Request.Headers) {
+				validateRegex(&fields, "request.headers."+name, (*exp.Request.Headers)[name])
+			}
+		}
+	}
+
+	if exp.Response != nil {
+		validateHTTPCode(&fields, "response.httpcode", exp.Response.HTTPCode)
+	}
+
+	if exp.Forward != nil {
+		fwd := exp.Forward
+		validateScheme(&fields, "forward.scheme", fwd.Scheme)
+		if fwd.Host == "" && len(fwd.Hosts) == 0 {
+			addError("forward.host", "one of host or hosts is required")
+		}
+		for i, host := range fwd.Hosts {
+			if host == "" {
+				addError(fmt.Sprintf("forward.hosts[%d]", i), "host can't be empty")
+			}
+		}
+		switch fwd.Strategy {
+		case "", BalancerRoundRobin, BalancerRandom, BalancerFailover:
+		default:
+			addError("forward.strategy", "strategy %s is unknown, use %s, %s or %s", fwd.Strategy, BalancerRoundRobin, BalancerRandom, BalancerFailover)
+		}
+		if fwd.Timeout < 0 {
+			addError("forward.timeout", "timeout can't be negative")
+		}
+		if fwd.Transform != nil {
+			if fwd.Transform.HTTPCode != 0 {
+				validateHTTPCode(&fields, "forward.transform.httpcode", fwd.Transform.HTTPCode)
+			}
+			for i, set := range fwd.Transform.Set {
+				if _, err := parseJSONPath(set.Path); err != nil {
+					addError(fmt.Sprintf("forward.transform.set[%d].path", i), "%s", err)
+				}
+			}
+			for i, replace := range fwd.Transform.Replace {
+				if _, err := regexp.Compile(replace.Regex); err != nil {
+					addError(fmt.Sprintf("forward.transform.replace[%d].regex", i), "invalid regex: %s", err)
+				}
+			}
+		}
+		if fwd.OnError != nil && fwd.OnError.Response != nil {
+			validateHTTPCode(&fields, "forward.onerror.response.httpcode", fwd.OnError.Response.HTTPCode)
+		}
+	}
+
+	if exp.Mirror != nil {
+		validateScheme(&fields, "mirror.scheme", exp.Mirror.Scheme)
+		if exp.Mirror.Host == "" {
+			addError("mirror.host", "host is required")
+		}
+		if exp.Mirror.Timeout < 0 {
+			addError("mirror.timeout", "timeout can't be negative")
+		}
+	}
+
+	return fields
+}
+
+func validateRegex(fields *[]APIFieldError, field string, filter string) {
+	if filter == "" {
+		return
+	}
+	if _, err := regexp.Compile("(?s)" + filter); err != nil {
+		*fields = append(*fields, APIFieldError{Field: field, Message: "invalid regex: " + err.Error()})
+	}
+}
+
+func validateHTTPCode(fields *[]APIFieldError, field string, code int) {
+	if code < 100 || code > 599 {
+		*fields = append(*fields, APIFieldError{Field: field, Message: fmt.Sprintf("HTTP code %d should be between 100 and 599", code)})
+	}
+}
+
+func validateScheme(fields *[]APIFieldError, field string, scheme string) {
+	switch scheme {
+	case "", "http", "https":
+	default:
+		*fields = append(*fields, APIFieldError{Field: field, Message: fmt.Sprintf("scheme %s is unknown, use http or https", scheme)})
+	}
+}
+
+func sortedHeaderNames(headers *Headers) []string {
+	names := make([]string, 0, len(*headers))
+	for name := range *headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedLabelNames(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedObjectNames(object map[string]interface{}) []string {
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateUnknownFields returns fields of decoded JSON value which don't exist in type t.
+// Names are compared case-insensitively like in encoding/json
+func ValidateUnknownFields(value interface{}, t reflect.Type, path string) []APIFieldError {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == rawMessageType {
+		return nil
+	}
+
+	fields := []APIFieldError{}
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for _, name := range sortedObjectNames(object) {
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+			field, ok := validateStructField(t, name)
+			if !ok {
+				fields = append(fields, APIFieldError{Field: fieldPath, Message: "unknown field"})
+				continue
+			}
+			fields = append(fields, ValidateUnknownFields(object[name], field.Type, fieldPath)...)
+		}
+	case reflect.Slice, reflect.Array:
+		array, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, item := range array {
+			fields = append(fields, ValidateUnknownFields(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case reflect.Map:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for _, name := range sortedObjectNames(object) {
+			fields = append(fields, ValidateUnknownFields(object[name], t.Elem(), path+"."+name)...)
+		}
+	}
+	return fields
+}
+
+// validateStructField finds exported field of struct by JSON name
+func validateStructField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		jsonName := strings.Split(field.Tag.Get("json"), ",")[0]
+		if jsonName == "-" {
+			continue
+		}
+		if jsonName == "" {
+			jsonName = field.Name
+		}
+		if strings.EqualFold(jsonName, name) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
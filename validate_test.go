@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpectationValidate_ValidExpectations_NoErrors(t *testing.T) {
+	assert.Empty(t, ExpectationValidate(Expectation{
+		Key:      "k",
+		Request:  &ExpectationRequest{Path: "^/user/[0-9]+$", Headers: &Headers{"Accept": "json"}},
+		Response: &ExpectationResponse{HTTPCode: 200}}))
+	assert.Empty(t, ExpectationValidate(Expectation{
+		Key: "k",
+		Forward: &ExpectationForward{
+			Scheme:    "https",
+			Hosts:     []string{"a", "b"},
+			Strategy:  BalancerFailover,
+			Transform: &ExpectationTransform{Set: []ExpectationJSONPathSet{{Path: "$.a[0]"}}}},
+		Mirror: &ExpectationMirror{Host: "mirror"}}))
+}
+
+func TestExpectationValidate_Actions(t *testing.T) {
+	assert.Equal(t, []APIFieldError{{Field: "response", Message: "one of response or forward is required"}},
+		ExpectationValidate(Expectation{Key: "k"}))
+	assert.Equal(t, []APIFieldError{{Field: "forward", Message: "only one of response or forward can be set"}},
+		ExpectationValidate(Expectation{Key: "k", Response: &ExpectationResponse{HTTPCode: 200}, Forward: &ExpectationForward{Host: "h"}}))
+}
+
+func TestExpectationValidate_KeyWithNUL_Error(t *testing.T) {
+	assert.Equal(t, []APIFieldError{{Field: "key", Message: "key can't contain NUL character"}},
+		ExpectationValidate(Expectation{Key: "\x00unmatched", Response: &ExpectationResponse{HTTPCode: 200}}))
+}
+
+func TestExpectationValidate_InvalidFields_AllErrors(t *testing.T) {
+	fields := ExpectationValidate(Expectation{
+		Key:     "k",
+		Request: &ExpectationRequest{Path: "/user/(", Headers: &Headers{"X": "[a"}},
+		Forward: &ExpectationForward{
+			Scheme:   "ftp",
+			Strategy: "fastest",
+			Transform: &ExpectationTransform{
+				HTTPCode: 99,
+				Set:      []ExpectationJSONPathSet{{Path: "a.b"}},
+				Replace:  []ExpectationReplace{{Regex: "*"}}},
+			OnError: &ExpectationOnError{Response: &ExpectationResponse{HTTPCode: 600}}},
+		Mirror: &ExpectationMirror{}})
+
+	names := []string{}
+	for _, field := range fields {
+		names = append(names, field.Field)
+	}
+	assert.Equal(t, []string{
+		"request.path",
+		"request.headers.X",
+		"forward.scheme",
+		"forward.host",
+		"forward.strategy",
+		"forward.transform.httpcode",
+		"forward.transform.set[0].path",
+		"forward.transform.replace[0].regex",
+		"forward.onerror.response.httpcode",
+		"mirror.host"}, names)
+	assert.Contains(t, fields[0].Message, "invalid regex")
+	assert.Equal(t, "HTTP code 99 should be between 100 and 599", fields[5].Message)
+}
+
+func TestExpectationValidate_InvalidLabels(t *testing.T) {
+	fields := ExpectationValidate(Expectation{
+		Key:      "k",
+		Response: &ExpectationResponse{HTTPCode: 200},
+		Labels:   map[string]string{"suite": "checkout", "a=b": "c", "env": "qa,prod"}})
+	assert.Equal(t, []APIFieldError{
+		{Field: "labels.a=b", Message: "label name should be non-empty and contain only letters, digits, ., _, / and -"},
+		{Field: "labels.env", Message: "label value should contain only letters, digits, ., _, / and -"}}, fields)
+}
+
+func TestValidateUnknownFields_NestedFields(t *testing.T) {
+	var raw interface{}
+	assert.NoError(t, unmarshalJSON([]byte(`{
+		"Key": "k",
+		"respons": {},
+		"request": {"path": "/", "headers": {"X": "1"}, "proxied": true},
+		"forward": {"host": "h", "transform": {"mergepatch": {"any": 1}, "set": [{"path": "$.a", "valu": 1}]}}}`), &raw))
+
+	assert.Equal(t, []APIFieldError{
+		{Field: "forward.transform.set[0].valu", Message: "unknown field"},
+		{Field: "request.proxied", Message: "unknown field"},
+		{Field: "respons", Message: "unknown field"}},
+		ValidateUnknownFields(raw, reflect.TypeOf(Expectation{}), ""))
+}
+
+func TestValidateUnknownFields_MapValues_SortedByName(t *testing.T) {
+	var raw interface{}
+	assert.NoError(t, unmarshalJSON([]byte(`{"c": [{"kee": "1"}], "a": [{"kee": "2"}], "b": [{"kee": "3"}]}`), &raw))
+
+	assert.Equal(t, []APIFieldError{
+		{Field: "namespaces.a[0].kee", Message: "unknown field"},
+		{Field: "namespaces.b[0].kee", Message: "unknown field"},
+		{Field: "namespaces.c[0].kee", Message: "unknown field"}},
+		ValidateUnknownFields(raw, reflect.TypeOf(map[string][]Expectation{}), "namespaces"))
+}
+
+func TestExpectationFromReadCloser_UnknownAndInvalidFields_AllErrors(t *testing.T) {
+	_, err := ExpectationFromReadCloser(ioutil.NopCloser(strings.NewReader(
+		`{"key": "k", "reponse": {"httpcode": 200}, "request": {"path": "("}}`)))
+	apiErr, ok := err.(*APIError)
+	assert.True(t, ok)
+	assert.Equal(t, 422, apiErr.Status)
+	assert.Len(t, apiErr.Fields, 3)
+	assert.Equal(t, "reponse", apiErr.Fields[0].Field)
+	assert.Equal(t, "response", apiErr.Fields[1].Field)
+	assert.Equal(t, "request.path", apiErr.Fields[2].Field)
+}
+
+func TestExpectationsFromString_UnknownField_IndexInField(t *testing.T) {
+	_, err := ExpectationsFromString(`[{"key": "k", "response": {"httpcode": 200, "code": 1}}]`)
+	apiErr, ok := err.(*APIError)
+	assert.True(t, ok)
+	assert.Equal(t, []APIFieldError{{Field: "[0].response.code", Message: "unknown field"}}, apiErr.Fields)
+}
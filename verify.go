@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Verification checks number of received requests which pass filter.
+// If no count constraint is set, at least one request is expected
+type Verification struct {
+	Request *ExpectationRequest `json:"request,omitempty"`
+	Labels  string              `json:"labels,omitempty"`
+	Exactly *int                `json:"exactly,omitempty"`
+	AtLeast *int                `json:"atleast,omitempty"`
+	AtMost  *int                `json:"atmost,omitempty"`
+}
+
+// VerificationSequence checks that requests passing filters were received in listed order
+type VerificationSequence struct {
+	Requests []ExpectationRequest `json:"requests"`
+	Labels   string               `json:"labels,omitempty"`
+}
+
+// VerificationResult is result of verification. Requests are the requests which pass filter
+type VerificationResult struct {
+	Passed   bool           `json:"passed"`
+	Message  string         `json:"message,omitempty"`
+	Count    int            `json:"count"`
+	Requests []JournalEntry `json:"requests"`
+}
+
+// Verify checks number of requests in journal of namespace which pass verification filter.
+// Labels is selector of labels of applied expectations, it should be validated before
+func Verify(namespace string, v Verification) VerificationResult {
+	selector, _ := ParseLabelSelector(v.Labels)
+	entries := JournalGet(JournalFilter{Namespace: namespace, Request: v.Request, Labels: selector})
+	count := len(entries)
+	result := VerificationResult{Passed: true, Count: count, Requests: entries}
+
+	if v.Exactly == nil && v.AtLeast == nil && v.AtMost == nil {
+		atLeastOne := 1
+		v.AtLeast = &atLeastOne
+	}
+
+	if v.Exactly != nil && count != *v.Exactly {
+		result.Passed = false
+		result.Message = fmt.Sprintf("expected exactly %d requests, received %d", *v.Exactly, count)
+	} else if v.AtLeast != nil && count < *v.AtLeast {
+		result.Passed = false
+		result.Message = fmt.Sprintf("expected at least %d requests, received %d", *v.AtLeast, count)
+	} else if v.AtMost != nil && count > *v.AtMost {
+		result.Passed = false
+		result.Message = fmt.Sprintf("expected at most %d requests, received %d", *v.AtMost, count)
+	}
+	return result
+}
+
+// VerifySequence checks that journal of namespace contains requests passing filters in the same order.
+// Other requests can be received between them. Labels is selector of labels of applied expectations
+func VerifySequence(namespace string, v VerificationSequence) VerificationResult {
+	selector, _ := ParseLabelSelector(v.Labels)
+	entries := JournalGet(JournalFilter{Namespace: namespace, Labels: selector})
+	result := VerificationResult{Passed: true, Requests: []JournalEntry{}}
+
+	next := 0
+	for i := range v.Requests {
+		found := false
+		for ; next < len(entries); next++ {
+			if ControllerRequestPassesFilter(&entries[next].Request, &v.Requests[i]) {
+				result.Requests = append(result.Requests, entries[next])
+				found = true
+				next++
+				break
+			}
+		}
+		if !found {
+			result.Passed = false
+			if i == 0 {
+				result.Message = "request #1 of sequence wasn't received"
+			} else {
+				result.Message = fmt.Sprintf("request #%d of sequence wasn't received after request #%d", i+1, i)
+			}
+			break
+		}
+	}
+	result.Count = len(result.Requests)
+	return result
+}
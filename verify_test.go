@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func verifyTestJournal(paths ...string) {
+	JournalReset()
+	for _, path := range paths {
+		JournalAdd(time.Now(), &ExpectationRequest{Method: "GET", Path: path}, "", nil, JournalResponse{})
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestVerify_NoConstraint_AtLeastOne(t *testing.T) {
+	verifyTestJournal("/a")
+	defer JournalReset()
+
+	assert.True(t, Verify("", Verification{Request: &ExpectationRequest{Path: "/a"}}).Passed)
+	result := Verify("", Verification{Request: &ExpectationRequest{Path: "/b"}})
+	assert.False(t, result.Passed)
+	assert.Equal(t, "expected at least 1 requests, received 0", result.Message)
+}
+
+func TestVerify_Exactly(t *testing.T) {
+	verifyTestJournal("/a", "/a", "/b")
+	defer JournalReset()
+
+	assert.True(t, Verify("", Verification{Request: &ExpectationRequest{Path: "/a"}, Exactly: intPtr(2)}).Passed)
+	assert.True(t, Verify("", Verification{Request: &ExpectationRequest{Path: "/c"}, Exactly: intPtr(0)}).Passed)
+
+	result := Verify("", Verification{Request: &ExpectationRequest{Path: "/a"}, Exactly: intPtr(1)})
+	assert.False(t, result.Passed)
+	assert.Equal(t, 2, result.Count)
+	assert.Len(t, result.Requests, 2)
+}
+
+func TestVerify_AtLeastAtMost(t *testing.T) {
+	verifyTestJournal("/a", "/a", "/a")
+	defer JournalReset()
+
+	filter := &ExpectationRequest{Path: "/a"}
+	assert.True(t, Verify("", Verification{Request: filter, AtLeast: intPtr(2), AtMost: intPtr(3)}).Passed)
+	assert.False(t, Verify("", Verification{Request: filter, AtLeast: intPtr(4)}).Passed)
+
+	result := Verify("", Verification{Request: filter, AtMost: intPtr(2)})
+	assert.False(t, result.Passed)
+	assert.Equal(t, "expected at most 2 requests, received 3", result.Message)
+}
+
+func TestVerifySequence_InOrder_Passed(t *testing.T) {
+	verifyTestJournal("/login", "/other", "/cart", "/pay")
+	defer JournalReset()
+
+	result := VerifySequence("", VerificationSequence{Requests: []ExpectationRequest{{Path: "/login"}, {Path: "/cart"}, {Path: "/pay"}}})
+	assert.True(t, result.Passed)
+	assert.Equal(t, 3, result.Count)
+	assert.Equal(t, "/pay", result.Requests[2].Request.Path)
+}
+
+func TestVerifySequence_WrongOrder_Failed(t *testing.T) {
+	verifyTestJournal("/cart", "/login")
+	defer JournalReset()
+
+	result := VerifySequence("", VerificationSequence{Requests: []ExpectationRequest{{Path: "/login"}, {Path: "/cart"}}})
+	assert.False(t, result.Passed)
+	assert.Equal(t, "request #2 of sequence wasn't received after request #1", result.Message)
+	assert.Len(t, result.Requests, 1)
+
+	result = VerifySequence("", VerificationSequence{Requests: []ExpectationRequest{{Path: "/pay"}}})
+	assert.False(t, result.Passed)
+	assert.Equal(t, "request #1 of sequence wasn't received", result.Message)
+}
+
+func TestVerify_Labels_OnlyRequestsOfLabeledExpectations(t *testing.T) {
+	JournalReset()
+	defer JournalReset()
+	suiteA := map[string]string{"suite": "a"}
+	suiteB := map[string]string{"suite": "b"}
+
+	JournalAdd(time.Now(), &ExpectationRequest{Path: "/login"}, "verify_suite_a", suiteA, JournalResponse{})
+	JournalAdd(time.Now(), &ExpectationRequest{Path: "/login"}, "verify_suite_b", suiteB, JournalResponse{})
+	JournalAdd(time.Now(), &ExpectationRequest{Path: "/cart"}, "verify_suite_b", suiteB, JournalResponse{})
+
+	assert.True(t, Verify("", Verification{Request: &ExpectationRequest{Path: "/login"}, Labels: "suite=a", Exactly: intPtr(1)}).Passed)
+	assert.True(t, Verify("", Verification{Labels: "suite=b", Exactly: intPtr(2)}).Passed)
+
+	assert.True(t, VerifySequence("", VerificationSequence{Requests: []ExpectationRequest{{Path: "/login"}, {Path: "/cart"}}, Labels: "suite=b"}).Passed)
+	assert.False(t, VerifySequence("", VerificationSequence{Requests: []ExpectationRequest{{Path: "/login"}, {Path: "/cart"}}, Labels: "suite=a"}).Passed)
+}